@@ -0,0 +1,179 @@
+package env
+
+import (
+	"fmt"
+	"github.com/ajmyyra/docker-fpm/pkg/fpm"
+	"github.com/pkg/errors"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ConfigError lists the required variables that are missing and the ones with invalid values.
+type ConfigError struct {
+	Missing []string
+	Invalid []string
+}
+
+func (e *ConfigError) Error() string {
+	problems := []string{}
+	if len(e.Missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing %s", strings.Join(e.Missing, ", ")))
+	}
+	if len(e.Invalid) > 0 {
+		problems = append(problems, fmt.Sprintf("invalid %s", strings.Join(e.Invalid, ", ")))
+	}
+
+	return fmt.Sprintf("Invalid configuration in environment: %s", strings.Join(problems, "; "))
+}
+
+// required fields have to be set, apart from ContainerPort which can be replaced by ContainerPorts.
+var required = []string{"Deployment", "ContainerImage", "ContainerImageTag"}
+
+// LoadFromEnv reads a controller configuration from environment variables named after the
+// fields with the prefix, e.g. FPM_CONTAINER_IMAGE for ContainerImage with prefix FPM.
+// Fields not set in the environment keep the values of fpm.DefaultConfig. Lists are
+// comma-separated and maps comma-separated key=value pairs. Struct fields like RegistryAuth
+// are read field by field (FPM_REGISTRY_AUTH_USERNAME), while functions, interfaces and
+// pointers can't be set from the environment.
+func LoadFromEnv(prefix string) (fpm.ControllerConfig, error) {
+	prefix = strings.TrimSuffix(prefix, "_")
+	if prefix != "" {
+		prefix += "_"
+	}
+
+	confErr := &ConfigError{}
+	for _, field := range required {
+		if _, ok := os.LookupEnv(prefix + VarName(field)); !ok {
+			confErr.Missing = append(confErr.Missing, prefix+VarName(field))
+		}
+	}
+	_, hasPort := os.LookupEnv(prefix + VarName("ContainerPort"))
+	_, hasPorts := os.LookupEnv(prefix + VarName("ContainerPorts"))
+	if !hasPort && !hasPorts {
+		confErr.Missing = append(confErr.Missing, prefix+VarName("ContainerPort"))
+	}
+
+	conf := fpm.DefaultConfig("", "", "", 0)
+	conf.ContainerPorts = nil
+	load(reflect.ValueOf(&conf).Elem(), prefix, confErr)
+	if len(conf.ContainerPorts) == 0 && conf.ContainerPort > 0 {
+		conf.ContainerPorts = []int{conf.ContainerPort}
+	}
+
+	if len(confErr.Missing) > 0 || len(confErr.Invalid) > 0 {
+		return fpm.ControllerConfig{}, confErr
+	}
+
+	return conf, nil
+}
+
+// load sets the fields of the struct from the variables found in the environment.
+func load(v reflect.Value, prefix string, confErr *ConfigError) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + VarName(field.Name)
+
+		if field.Type.Kind() == reflect.Struct {
+			load(v.Field(i), name+"_", confErr)
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := set(v.Field(i), value); err != nil {
+			confErr.Invalid = append(confErr.Invalid, fmt.Sprintf("%s (%s)", name, err))
+		}
+	}
+}
+
+func set(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range splitList(value) {
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := set(elem, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, elem)
+		}
+		field.Set(items)
+	case reflect.Map:
+		if field.Type().Key().Kind() != reflect.String || field.Type().Elem().Kind() != reflect.String {
+			return errors.New("not supported")
+		}
+		m := map[string]string{}
+		for _, pair := range splitList(value) {
+			k, v, found := strings.Cut(pair, "=")
+			if !found || k == "" {
+				return errors.New(fmt.Sprintf("%q is not a key=value pair", pair))
+			}
+			m[k] = v
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		return errors.New("can't be set from the environment")
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// VarName converts a field name to its environment variable name, e.g. ContainerImageTag to
+// CONTAINER_IMAGE_TAG, FCGIParamMapper to FCGI_PARAM_MAPPER and TrustedProxyCIDRs to
+// TRUSTED_PROXY_CIDRS.
+func VarName(field string) string {
+	runes := []rune(field)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			// a plural acronym like CIDRs stays in one piece
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1]) && !(runes[i+1] == 's' && i+2 == len(runes))
+			if unicode.IsLower(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+
+package docker
+
+import (
+	"context"
+	"github.com/docker/docker/pkg/stdcopy"
+	"io"
+	"net"
+)
+
+// ContainerStreams is an attached session to a container. Reads return the container's
+// stdout and writes go to its stdin, while stderr is read separately from Stderr. Both have
+// to be read, as output stops while either one is full.
+type ContainerStreams struct {
+	conn   net.Conn
+	stdout *io.PipeReader
+	Stderr io.Reader
+}
+
+func (s *ContainerStreams) Read(p []byte) (int, error) {
+	return s.stdout.Read(p)
+}
+
+func (s *ContainerStreams) Write(p []byte) (int, error) {
+	return s.conn.Write(p)
+}
+
+// CloseWrite closes the container's stdin, leaving the output readable until the container
+// has finished writing.
+func (s *ContainerStreams) CloseWrite() error {
+	if cw, ok := s.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return nil
+}
+
+func (s *ContainerStreams) Close() error {
+	s.stdout.Close()
+	return s.conn.Close()
+}
+
+// AttachContainerStreams attaches to a running container created with AttachStdin, splitting
+// its multiplexed output into separate stdout and stderr streams. Containers with a TTY
+// don't multiplex their output, so AttachContainer has to be used for them instead.
+func (s Client) AttachContainerStreams(ctx context.Context, id string) (*ContainerStreams, error) {
+	conn, err := s.AttachContainer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutW, stderrW, conn)
+		stdoutW.CloseWithError(err)
+		stderrW.CloseWithError(err)
+	}()
+
+	return &ContainerStreams{
+		conn:   conn,
+		stdout: stdoutR,
+		Stderr: stderrR,
+	}, nil
+}
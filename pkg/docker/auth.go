@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type AuthConfig struct {
+	Username      string
+	Password      string
+	ServerAddress string
+	RegistryToken string
+}
+
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+}
+
+func (a AuthConfig) empty() bool {
+	return a == AuthConfig{}
+}
+
+// encode returns the auth config in the base64 encoded JSON format expected by the Docker API.
+func (a AuthConfig) encode() (string, error) {
+	if a.empty() {
+		return "", nil
+	}
+
+	js, err := json.Marshal(types.AuthConfig{
+		Username:      a.Username,
+		Password:      a.Password,
+		ServerAddress: a.ServerAddress,
+		RegistryToken: a.RegistryToken,
+	})
+	if err != nil {
+		return "", clientError(err, "", "Unable to encode registry credentials")
+	}
+
+	return base64.URLEncoding.EncodeToString(js), nil
+}
+
+// NewAuthFromDockerConfig reads registry credentials stored by `docker login`. When configPath
+// is empty, ~/.docker/config.json is used. The file must contain credentials for exactly one
+// registry, as there would be no way of telling which one to use otherwise.
+func NewAuthFromDockerConfig(configPath string) (AuthConfig, error) {
+	if configPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return AuthConfig{}, clientError(err, "", "Unable to find home directory")
+		}
+		configPath = filepath.Join(home, ".docker", "config.json")
+	}
+
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return AuthConfig{}, clientError(err, "", fmt.Sprintf("Unable to read Docker config %s", configPath))
+	}
+
+	var conf dockerConfigFile
+	if err := json.Unmarshal(content, &conf); err != nil {
+		return AuthConfig{}, clientError(err, "", fmt.Sprintf("Unable to parse Docker config %s", configPath))
+	}
+
+	if len(conf.Auths) != 1 {
+		return AuthConfig{}, errors.New(fmt.Sprintf("Expected credentials for one registry in %s, found %d", configPath, len(conf.Auths)))
+	}
+
+	for server, entry := range conf.Auths {
+		auth := AuthConfig{
+			ServerAddress: server,
+			RegistryToken: entry.IdentityToken,
+		}
+
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return AuthConfig{}, clientError(err, "", fmt.Sprintf("Invalid credentials for registry %s", server))
+			}
+
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return AuthConfig{}, errors.New(fmt.Sprintf("Invalid credentials for registry %s", server))
+			}
+			auth.Username, auth.Password = parts[0], parts[1]
+		}
+
+		return auth, nil
+	}
+
+	return AuthConfig{}, nil
+}
@@ -0,0 +1,45 @@
+//go:build criu
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+)
+
+// WithCheckpointDir returns a copy of the client that stores checkpoints in dir.
+func (s Client) WithCheckpointDir(dir string) Client {
+	s.config.CheckpointDir = dir
+	return s
+}
+
+// CheckpointContainer saves the container's process state with CRIU to the CheckpointDir of
+// the client, leaving it running. Requires the Docker daemon's experimental features.
+func (s Client) CheckpointContainer(ctx context.Context, id, checkpointID string) error {
+	s.config.Logger.DebugContext(ctx, "checkpointing container", "id", ShortID(id), "checkpoint", checkpointID)
+
+	if err := s.cli.CheckpointCreate(ctx, id, types.CheckpointCreateOptions{
+		CheckpointID:  checkpointID,
+		CheckpointDir: s.config.CheckpointDir,
+	}); err != nil {
+		return clientError(err, id, fmt.Sprintf("Unable to checkpoint container %s", ShortID(id)))
+	}
+
+	return nil
+}
+
+// RestoreContainerFromCheckpoint starts a stopped container from a checkpoint made with
+// CheckpointContainer, restoring its memory state.
+func (s Client) RestoreContainerFromCheckpoint(ctx context.Context, id, checkpointID string) error {
+	s.config.Logger.DebugContext(ctx, "restoring container", "id", ShortID(id), "checkpoint", checkpointID)
+
+	if err := s.cli.ContainerStart(ctx, id, types.ContainerStartOptions{
+		CheckpointID:  checkpointID,
+		CheckpointDir: s.config.CheckpointDir,
+	}); err != nil {
+		return clientError(err, id, fmt.Sprintf("Unable to restore container %s from checkpoint %s", ShortID(id), checkpointID))
+	}
+
+	return nil
+}
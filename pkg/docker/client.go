@@ -1,104 +1,455 @@
 package docker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"github.com/containerd/containerd/platforms"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
 )
 
+type ClientConfig struct {
+	// Amount of attempts for retryable Docker API calls. Values below 2 disable retrying.
+	RetryMaxAttempts int
+	// Logger for container lifecycle events. Defaults to slog.Default().
+	Logger *slog.Logger
+	// Limits the rate of Docker API calls when set
+	Limiter *rate.Limiter
+	// Attempts and delay between them for Reconnect after the daemon has become unreachable
+	ReconnectMaxAttempts int
+	ReconnectDelayMs     int
+	// Directory for CRIU checkpoints. Empty uses the Docker default location.
+	CheckpointDir string
+}
+
 type Client struct {
-	cli *client.Client
+	cli    *client.Client
+	config ClientConfig
 }
 
-func NewClient() (Client, error) {
-	c, err := client.NewClientWithOpts(client.FromEnv)
+func NewClient(config ClientConfig) (Client, error) {
+	opts := []client.Opt{client.FromEnv}
+	if config.Limiter != nil {
+		opts = append(opts, withLimiter(config.Limiter))
+	}
+
+	c, err := client.NewClientWithOpts(opts...)
 	if err != nil {
-		return Client{}, err
+		return Client{}, clientError(err, "", "Unable to initialize Docker client")
+	}
+
+	if config.Logger == nil {
+		config.Logger = slog.Default()
 	}
 
 	return Client{
-		cli: c,
+		cli:    c,
+		config: config,
 	}, nil
 }
 
-func (s Client) CreateContainer(name, image, deployment string) (string, error) {
-	fmt.Printf("Creating a new container %s (%s) for deployment %s.\n", name, image, deployment) // TODO debug
+const (
+	OrchestratorLabel = "orchestrator"
+	DeploymentLabel   = "deployment"
+	orchestratorName  = "docker-fpm"
+)
+
+type ContainerOptions struct {
+	Name       string
+	Image      string
+	Deployment string
+	Ports      []int
+	// Added alongside the orchestrator and deployment labels, which can't be overridden.
+	Labels map[string]string
+	// Network to attach the container to instead of the default bridge
+	Network string
+	// Use the container name as its hostname and as a DNS alias in Network
+	Alias bool
+	// Platform the container is created for, e.g. linux/amd64. Empty uses the daemon default.
+	Platform string
+	// Publish the exposed ports to random host ports
+	PublishPorts bool
+	// Keep stdin open for attaching to the container
+	AttachStdin bool
+	// tmpfs mounts by container path, with mount options as the value
+	Tmpfs map[string]string
+	// Log driver of the container and its options. Empty uses the daemon default.
+	LogDriver        string
+	LogDriverOptions map[string]string
+}
+
+// LogDrivers are the log drivers built into Docker.
+var LogDrivers = []string{"none", "local", "json-file", "syslog", "journald", "gelf", "fluentd", "awslogs", "splunk", "etwlogs", "gcplogs", "logentries"}
+
+// shortIDLength matches the IDs shown by the Docker CLI.
+const shortIDLength = 12
+
+// ShortID shortens a container ID for logs and metric labels.
+func ShortID(id string) string {
+	if len(id) > shortIDLength {
+		return id[:shortIDLength]
+	}
+
+	return id
+}
+
+// IsReservedLabel tells if the label key is used by docker-fpm itself.
+func IsReservedLabel(key string) bool {
+	return key == OrchestratorLabel || key == DeploymentLabel
+}
+
+func (s Client) CreateContainer(opts ContainerOptions) (string, error) {
+	s.config.Logger.Debug("creating container", "name", opts.Name, "image", opts.Image, "deployment", opts.Deployment)
 
 	// TODO support container.Config.Env
 
-	cont, err := s.cli.ContainerCreate(
-		context.Background(),
-		&container.Config{
-			Image:        image,
-			AttachStdout: true,
-			AttachStderr: true,
-			Labels: map[string]string{
-				"orchestrator": "docker-fpm",
-				"deployment":   deployment,
+	labels := map[string]string{
+		OrchestratorLabel: orchestratorName,
+		DeploymentLabel:   opts.Deployment,
+	}
+	for k, v := range opts.Labels {
+		if IsReservedLabel(k) {
+			return "", errors.New(fmt.Sprintf("Label %s is reserved for docker-fpm", k))
+		}
+		labels[k] = v
+	}
+
+	exposed := nat.PortSet{}
+	for _, port := range opts.Ports {
+		exposed[nat.Port(fmt.Sprintf("%d/tcp", port))] = struct{}{}
+	}
+
+	config := &container.Config{
+		Image:        opts.Image,
+		AttachStdout: true,
+		AttachStderr: true,
+		ExposedPorts: exposed,
+		Labels:       labels,
+		AttachStdin:  opts.AttachStdin,
+		OpenStdin:    opts.AttachStdin,
+	}
+
+	if opts.Alias {
+		config.Hostname = opts.Name
+	}
+
+	netConfig := &network.NetworkingConfig{}
+	hostConfig := &container.HostConfig{
+		Privileged: false,
+		// Resources: container.Resources{}, // TODO allow specifying these
+		// TODO mount support
+		/*Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: "/foo/source/dir",
+				Target: "/samp",
 			},
-		},
-		&container.HostConfig{
-			Privileged: false,
-			// Resources: container.Resources{}, // TODO allow specifying these
-			// TODO mount support
-			/*Mounts: []mount.Mount{
-				{
-					Type:   mount.TypeBind,
-					Source: "/foo/source/dir",
-					Target: "/samp",
-				},
-			},*/
-		},
-		&network.NetworkingConfig{},
-		nil,
-		name,
-	)
+		},*/
+	}
 
-	if err != nil {
-		return "", errors.Wrap(err, "Unable to create a new container")
+	hostConfig.PublishAllPorts = opts.PublishPorts
+	hostConfig.Tmpfs = opts.Tmpfs
+	if opts.LogDriver != "" {
+		hostConfig.LogConfig = container.LogConfig{
+			Type:   opts.LogDriver,
+			Config: opts.LogDriverOptions,
+		}
 	}
 
-	if len(cont.Warnings) > 0 {
-		fmt.Printf("%d warnings for created container %s:\n", len(cont.Warnings), cont.ID)
-		for _, warn := range cont.Warnings {
-			fmt.Println(warn)
+	if opts.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(opts.Network)
+		endpoint := &network.EndpointSettings{}
+		if opts.Alias {
+			endpoint.Aliases = []string{opts.Name}
+		}
+		netConfig.EndpointsConfig = map[string]*network.EndpointSettings{
+			opts.Network: endpoint,
+		}
+	}
+
+	var platform *specs.Platform
+	if opts.Platform != "" {
+		p, err := platforms.Parse(opts.Platform)
+		if err != nil {
+			return "", &ContainerCreateError{
+				ContainerName:  opts.Name,
+				DeploymentName: opts.Deployment,
+				OriginalError:  clientError(err, "", fmt.Sprintf("Invalid platform %s", opts.Platform)),
+			}
+		}
+		platform = &p
+	}
+
+	var cont container.ContainerCreateCreatedBody
+	err := s.withRetry(func() (err error) {
+		cont, err = s.cli.ContainerCreate(context.Background(), config, hostConfig, netConfig, platform, opts.Name)
+		return err
+	})
+
+	if err != nil {
+		return "", &ContainerCreateError{
+			ContainerName:  opts.Name,
+			DeploymentName: opts.Deployment,
+			OriginalError:  err,
 		}
 	}
 
+	for _, warn := range cont.Warnings {
+		s.config.Logger.Warn("warning for created container", "id", ShortID(cont.ID), "name", opts.Name, "warning", warn)
+	}
+
 	return cont.ID, nil
 }
 
+// PullImage pulls the image from its registry, authenticating with auth when it's set.
+// A non-empty platform (e.g. linux/arm64) selects the variant of a multi-arch image.
+func (s Client) PullImage(ctx context.Context, image, tag, platform string, auth AuthConfig) error {
+	return s.pullImage(ctx, image, tag, platform, auth, ioutil.Discard)
+}
+
+// PullImageWithRetry pulls the image like PullImage, retrying failed pulls up to maxAttempts
+// times with a delay of backoff times the attempt number. Pull progress is written to out.
+// The returned error includes the errors of every attempt.
+func (s Client) PullImageWithRetry(ctx context.Context, image, tag, platform string, auth AuthConfig, out io.Writer, maxAttempts int, backoff time.Duration) error {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	errs := []error{}
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := s.pullImage(ctx, image, tag, platform, auth, out)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, clientError(err, "", fmt.Sprintf("Attempt %d", attempt)))
+		s.config.Logger.WarnContext(ctx, "image pull failed", "image", fmt.Sprintf("%s:%s", image, tag), "attempt", attempt, "error", err)
+
+		if attempt < maxAttempts {
+			select {
+			case <-ctx.Done():
+				return clientError(stderrors.Join(append(errs, ctx.Err())...), "", fmt.Sprintf("Unable to pull image %s:%s", image, tag))
+			case <-time.After(backoff * time.Duration(attempt)):
+			}
+		}
+	}
+
+	return clientError(stderrors.Join(errs...), "", fmt.Sprintf("Unable to pull image %s:%s after %d attempts", image, tag, maxAttempts))
+}
+
+func (s Client) pullImage(ctx context.Context, image, tag, platform string, auth AuthConfig, progress io.Writer) error {
+	ref := fmt.Sprintf("%s:%s", image, tag)
+	s.config.Logger.DebugContext(ctx, "pulling image", "image", ref)
+
+	encodedAuth, err := auth.encode()
+	if err != nil {
+		return err
+	}
+
+	out, err := s.cli.ImagePull(ctx, ref, types.ImagePullOptions{
+		RegistryAuth: encodedAuth,
+		Platform:     platform,
+	})
+	if err != nil {
+		return clientError(err, "", fmt.Sprintf("Unable to pull image %s", ref))
+	}
+	defer out.Close()
+
+	// The pull is only complete once the progress stream has been consumed.
+	if _, err := io.Copy(progress, out); err != nil {
+		return clientError(err, "", fmt.Sprintf("Unable to pull image %s", ref))
+	}
+
+	return nil
+}
+
 func (s Client) StartContainer(id string) error {
-	fmt.Printf("Starting container %s...\n", id) // TODO debug
+	s.config.Logger.Debug("starting container", "id", ShortID(id))
 
-	if err := s.cli.ContainerStart(context.Background(), id, types.ContainerStartOptions{}); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to start container %s", id))
+	if err := s.withRetry(func() error {
+		return s.cli.ContainerStart(context.Background(), id, types.ContainerStartOptions{})
+	}); err != nil {
+		return &ContainerStartError{
+			ContainerID:   id,
+			OriginalError: err,
+		}
 	}
 
 	return nil
 }
 
+// ExecInContainer runs the command in a running container, waits for it to finish and
+// returns its exit code.
+func (s Client) ExecInContainer(ctx context.Context, id string, cmd []string) (int, error) {
+	exec, err := s.cli.ContainerExecCreate(ctx, id, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, clientError(err, id, fmt.Sprintf("Unable to create exec in container %s", ShortID(id)))
+	}
+
+	resp, err := s.cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, clientError(err, id, fmt.Sprintf("Unable to start exec in container %s", ShortID(id)))
+	}
+	defer resp.Close()
+
+	// Output isn't needed, but the command is only finished once its output stream closes.
+	if _, err := io.Copy(ioutil.Discard, resp.Reader); err != nil {
+		return 0, clientError(err, id, fmt.Sprintf("Unable to read exec output from container %s", ShortID(id)))
+	}
+
+	inspect, err := s.cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, clientError(err, id, fmt.Sprintf("Unable to inspect exec in container %s", ShortID(id)))
+	}
+
+	return inspect.ExitCode, nil
+}
+
+// AttachContainer attaches to the stdin, stdout and stderr of a running container. Output is
+// multiplexed as in FetchContainerLogs, unless the container has a TTY. The caller closes
+// the connection.
+func (s Client) AttachContainer(ctx context.Context, id string) (net.Conn, error) {
+	resp, err := s.cli.ContainerAttach(ctx, id, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, clientError(err, id, fmt.Sprintf("Unable to attach to container %s", ShortID(id)))
+	}
+
+	return resp.Conn, nil
+}
+
+// FetchContainerLogs returns the last tail lines of the container's stdout and stderr.
+func (s Client) FetchContainerLogs(ctx context.Context, id string, tail int) (string, error) {
+	out, err := s.cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(tail),
+	})
+	if err != nil {
+		return "", clientError(err, id, fmt.Sprintf("Unable to fetch logs for container %s", ShortID(id)))
+	}
+	defer out.Close()
+
+	// Containers run without a TTY, so stdout and stderr are multiplexed into the same stream.
+	var logs bytes.Buffer
+	if _, err := stdcopy.StdCopy(&logs, &logs, out); err != nil {
+		return "", clientError(err, id, fmt.Sprintf("Unable to read logs for container %s", ShortID(id)))
+	}
+
+	return logs.String(), nil
+}
+
 func (s Client) ContainerDetails(id string) (types.ContainerJSON, error) {
 	details, err := s.cli.ContainerInspect(context.Background(), id)
 	if err != nil {
-		return types.ContainerJSON{}, errors.Wrap(err, fmt.Sprintf("Unable to fetch details for container %s", id))
+		return types.ContainerJSON{}, clientError(err, id, fmt.Sprintf("Unable to fetch details for container %s", ShortID(id)))
 	}
 
 	return details, nil
 }
 
+// ContainerOOMCount returns 1 if the container's last exit was caused by running out of
+// memory, 0 otherwise. Docker only records the latest exit, so repeated kills have to be
+// counted by the caller, e.g. from oom events.
+func (s Client) ContainerOOMCount(ctx context.Context, id string) (int, error) {
+	details, err := s.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return 0, clientError(err, id, fmt.Sprintf("Unable to fetch details for container %s", ShortID(id)))
+	}
+
+	if details.State != nil && details.State.OOMKilled {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// ContainerRestartCount returns how many times Docker has restarted the container with its
+// restart policy.
+func (s Client) ContainerRestartCount(ctx context.Context, id string) (int, error) {
+	details, err := s.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return 0, clientError(err, id, fmt.Sprintf("Unable to fetch details for container %s", ShortID(id)))
+	}
+
+	return details.RestartCount, nil
+}
+
+// ContainerNetworkStats returns the bytes received and sent by the container over all of its
+// networks since it was started.
+func (s Client) ContainerNetworkStats(ctx context.Context, id string) (rxBytes, txBytes uint64, err error) {
+	res, err := s.cli.ContainerStats(ctx, id, false)
+	if err != nil {
+		return 0, 0, clientError(err, id, fmt.Sprintf("Unable to fetch stats for container %s", ShortID(id)))
+	}
+	defer res.Body.Close()
+
+	var stats types.StatsJSON
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return 0, 0, clientError(err, id, fmt.Sprintf("Unable to decode stats for container %s", ShortID(id)))
+	}
+
+	for _, n := range stats.Networks {
+		rxBytes += n.RxBytes
+		txBytes += n.TxBytes
+	}
+
+	return rxBytes, txBytes, nil
+}
+
+// GetContainerPort returns the host port the container's internal TCP port is published to.
+func (s Client) GetContainerPort(ctx context.Context, id string, internalPort int) (int, error) {
+	details, err := s.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return 0, clientError(err, id, fmt.Sprintf("Unable to fetch details for container %s", ShortID(id)))
+	}
+
+	if details.NetworkSettings != nil {
+		for _, binding := range details.NetworkSettings.Ports[nat.Port(fmt.Sprintf("%d/tcp", internalPort))] {
+			if port, err := strconv.Atoi(binding.HostPort); err == nil {
+				return port, nil
+			}
+		}
+	}
+
+	return 0, &DockerClientError{
+		Message:     fmt.Sprintf("Port %d of container %s is not published to the host", internalPort, ShortID(id)),
+		ContainerID: id,
+	}
+}
+
 func (s Client) listFilteredContainers(filters filters.Args) ([]types.Container, error) {
 	containers, err := s.cli.ContainerList(context.Background(), types.ContainerListOptions{
 		Filters: filters,
 	})
 
 	if err != nil {
-		return nil, errors.Wrap(err, "Unable to list containers")
+		return nil, clientError(err, "", "Unable to list containers")
 	}
 
 	return containers, nil
@@ -106,41 +457,111 @@ func (s Client) listFilteredContainers(filters filters.Args) ([]types.Container,
 
 func (s Client) ListAllContainers() ([]types.Container, error) {
 	filters := filters.Args{}
-	filters.Add("label", "orchestrator=docker-fpm")
+	filters.Add("label", fmt.Sprintf("%s=%s", OrchestratorLabel, orchestratorName))
 
 	return s.listFilteredContainers(filters)
 }
 
 func (s Client) ListDeploymentContainers(deployment string) ([]types.Container, error) {
 	filters := filters.Args{}
-	filters.Add("label", "orchestrator=docker-fpm")
-	filters.Add("label", fmt.Sprintf("deployment=%s", deployment))
+	filters.Add("label", fmt.Sprintf("%s=%s", OrchestratorLabel, orchestratorName))
+	filters.Add("label", fmt.Sprintf("%s=%s", DeploymentLabel, deployment))
 
 	return s.listFilteredContainers(filters)
 }
 
+// CopyToContainer extracts the tar archive content to dstPath, an existing directory in the container.
+func (s Client) CopyToContainer(ctx context.Context, id, dstPath string, content io.Reader) error {
+	if err := s.cli.CopyToContainer(ctx, id, dstPath, content, types.CopyToContainerOptions{}); err != nil {
+		return clientError(err, id, fmt.Sprintf("Unable to copy files to %s in container %s", dstPath, ShortID(id)))
+	}
+
+	return nil
+}
+
+// CopyFromContainer returns srcPath of the container as a tar archive. The caller has to
+// close the archive.
+func (s Client) CopyFromContainer(ctx context.Context, id, srcPath string) (io.ReadCloser, error) {
+	content, _, err := s.cli.CopyFromContainer(ctx, id, srcPath)
+	if err != nil {
+		return nil, clientError(err, id, fmt.Sprintf("Unable to copy %s from container %s", srcPath, ShortID(id)))
+	}
+
+	return content, nil
+}
+
+// UpdateContainer changes the resource limits of a container in place.
+func (s Client) UpdateContainer(ctx context.Context, id string, resources container.Resources) error {
+	res, err := s.cli.ContainerUpdate(ctx, id, container.UpdateConfig{Resources: resources})
+	if err != nil {
+		return clientError(err, id, fmt.Sprintf("Unable to update container %s", ShortID(id)))
+	}
+
+	for _, warn := range res.Warnings {
+		s.config.Logger.WarnContext(ctx, "warning for updated container", "id", ShortID(id), "warning", warn)
+	}
+
+	return nil
+}
+
+// PauseContainer freezes all processes of the container.
+func (s Client) PauseContainer(ctx context.Context, id string) error {
+	s.config.Logger.DebugContext(ctx, "pausing container", "id", ShortID(id))
+
+	if err := s.cli.ContainerPause(ctx, id); err != nil {
+		return clientError(err, id, fmt.Sprintf("Unable to pause container %s", ShortID(id)))
+	}
+
+	return nil
+}
+
+func (s Client) UnpauseContainer(ctx context.Context, id string) error {
+	s.config.Logger.DebugContext(ctx, "unpausing container", "id", ShortID(id))
+
+	if err := s.cli.ContainerUnpause(ctx, id); err != nil {
+		return clientError(err, id, fmt.Sprintf("Unable to unpause container %s", ShortID(id)))
+	}
+
+	return nil
+}
+
 func (s Client) StopContainer(id string) error {
-	fmt.Printf("Stopping container %s...\n", id) // TODO debug
+	s.config.Logger.Debug("stopping container", "id", ShortID(id))
 
 	if err := s.cli.ContainerStop(context.Background(), id, nil); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to stop container %s", id))
+		return clientError(err, id, fmt.Sprintf("Unable to stop container %s", ShortID(id)))
 	}
 
 	return nil
 }
 
+// WaitForContainer blocks until the container is no longer running and returns its exit code.
+func (s Client) WaitForContainer(ctx context.Context, id string) (int64, error) {
+	resultC, errC := s.cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+
+	select {
+	case res := <-resultC:
+		if res.Error != nil {
+			return res.StatusCode, errors.New(fmt.Sprintf("Error while waiting for container %s: %s", ShortID(id), res.Error.Message))
+		}
+		return res.StatusCode, nil
+	case err := <-errC:
+		return 0, clientError(err, id, fmt.Sprintf("Unable to wait for container %s", ShortID(id)))
+	}
+}
+
 func (s Client) KillContainer(id string) error {
-	fmt.Printf("Killing container %s...\n", id) // TODO debug
+	s.config.Logger.Debug("killing container", "id", ShortID(id))
 
 	if err := s.cli.ContainerKill(context.Background(), id, "SIGKILL"); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to kill container %s", id))
+		return clientError(err, id, fmt.Sprintf("Unable to kill container %s", ShortID(id)))
 	}
 
 	return nil
 }
 
 func (s Client) RemoveContainer(id string) error {
-	fmt.Printf("Removing container %s...\n", id) // TODO debug
+	s.config.Logger.Debug("removing container", "id", ShortID(id))
 
 	if err := s.cli.ContainerRemove(
 		context.Background(),
@@ -150,8 +571,156 @@ func (s Client) RemoveContainer(id string) error {
 			Force:         false,
 		},
 	); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to remove container %s", id))
+		return clientError(err, id, fmt.Sprintf("Unable to remove container %s", ShortID(id)))
+	}
+
+	return nil
+}
+
+// CreateNetwork creates a bridge network for the deployment. Internal networks have no
+// outbound connectivity outside of the host. Subnet and gateway are assigned by Docker
+// unless given.
+func (s Client) CreateNetwork(ctx context.Context, name, deployment string, internal bool, subnet, gateway string) (string, error) {
+	s.config.Logger.DebugContext(ctx, "creating network", "name", name, "deployment", deployment, "subnet", subnet)
+
+	opts := types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Internal:       internal,
+		Labels: map[string]string{
+			OrchestratorLabel: orchestratorName,
+			DeploymentLabel:   deployment,
+		},
+	}
+	if subnet != "" {
+		opts.IPAM = &network.IPAM{
+			Config: []network.IPAMConfig{{Subnet: subnet, Gateway: gateway}},
+		}
+	}
+
+	res, err := s.cli.NetworkCreate(ctx, name, opts)
+	if err != nil {
+		return "", clientError(err, "", fmt.Sprintf("Unable to create network %s", name))
+	}
+
+	if res.Warning != "" {
+		s.config.Logger.WarnContext(ctx, "warning for created network", "name", name, "warning", res.Warning)
+	}
+
+	return res.ID, nil
+}
+
+// NetworkExists checks whether a network with the exact given name exists.
+func (s Client) NetworkExists(ctx context.Context, name string) (bool, error) {
+	networks, err := s.cli.NetworkList(ctx, types.NetworkListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", name)),
+	})
+	if err != nil {
+		return false, clientError(err, "", fmt.Sprintf("Unable to list networks named %s", name))
+	}
+
+	// The name filter also matches partial names.
+	for _, n := range networks {
+		if n.Name == name {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// DeploymentSubnets returns the subnets of networks created by docker-fpm, mapped to the
+// deployment they belong to.
+func (s Client) DeploymentSubnets(ctx context.Context) (map[string]string, error) {
+	networks, err := s.cli.NetworkList(ctx, types.NetworkListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", OrchestratorLabel, orchestratorName))),
+	})
+	if err != nil {
+		return nil, clientError(err, "", "Unable to list networks")
+	}
+
+	subnets := map[string]string{}
+	for _, n := range networks {
+		for _, conf := range n.IPAM.Config {
+			if conf.Subnet != "" {
+				subnets[conf.Subnet] = n.Labels[DeploymentLabel]
+			}
+		}
+	}
+
+	return subnets, nil
+}
+
+func (s Client) RemoveNetwork(ctx context.Context, id string) error {
+	s.config.Logger.DebugContext(ctx, "removing network", "id", ShortID(id))
+
+	if err := s.cli.NetworkRemove(ctx, id); err != nil {
+		return clientError(err, "", fmt.Sprintf("Unable to remove network %s", ShortID(id)))
 	}
 
 	return nil
 }
+
+// RemoveVolume removes a named volume created by docker-fpm. Volumes lacking the
+// orchestrator label are left alone, as they're not ours to remove.
+func (s Client) RemoveVolume(name string) error {
+	vol, err := s.cli.VolumeInspect(context.Background(), name)
+	if err != nil {
+		return clientError(err, "", fmt.Sprintf("Unable to inspect volume %s", name))
+	}
+
+	if vol.Labels[OrchestratorLabel] != orchestratorName {
+		return nil
+	}
+
+	s.config.Logger.Debug("removing volume", "name", name)
+
+	if err := s.cli.VolumeRemove(context.Background(), name, false); err != nil {
+		return clientError(err, "", fmt.Sprintf("Unable to remove volume %s", name))
+	}
+
+	return nil
+}
+
+// IsNotFound tells if the error was caused by a container or other object not existing in Docker.
+func IsNotFound(err error) bool {
+	return errdefs.IsNotFound(err)
+}
+
+// PruneDeploymentContainers removes exited and never started containers of the deployment
+// that were created more than olderThan ago, except for the ones listed in keep. IDs of
+// the removed containers are returned.
+func (s Client) PruneDeploymentContainers(ctx context.Context, deployment string, olderThan time.Duration, keep ...string) ([]string, error) {
+	kept := map[string]bool{}
+	for _, id := range keep {
+		kept[id] = true
+	}
+
+	filters := filters.NewArgs()
+	filters.Add("label", fmt.Sprintf("%s=%s", OrchestratorLabel, orchestratorName))
+	filters.Add("label", fmt.Sprintf("%s=%s", DeploymentLabel, deployment))
+	filters.Add("status", "exited")
+	filters.Add("status", "created")
+
+	containers, err := s.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters,
+	})
+	if err != nil {
+		return nil, clientError(err, "", fmt.Sprintf("Unable to list stopped containers for deployment %s", deployment))
+	}
+
+	removed := []string{}
+	for _, c := range containers {
+		if kept[c.ID] || time.Since(time.Unix(c.Created, 0)) < olderThan {
+			continue
+		}
+
+		if err := s.cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{}); err != nil {
+			return removed, clientError(err, c.ID, fmt.Sprintf("Unable to remove container %s", ShortID(c.ID)))
+		}
+		removed = append(removed, c.ID)
+	}
+
+	return removed, nil
+}
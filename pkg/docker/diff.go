@@ -0,0 +1,41 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// changeKinds maps the change kinds of the Docker API to names.
+var changeKinds = map[uint8]string{
+	0: "Modified",
+	1: "Added",
+	2: "Deleted",
+}
+
+// ContainerChange is a filesystem change in a container compared to its image. Kind is
+// one of Added, Modified or Deleted.
+type ContainerChange struct {
+	Path string
+	Kind string
+}
+
+// ContainerDiff lists the changes made to the container's filesystem. Writes to volumes
+// and tmpfs mounts are not included.
+func (s Client) ContainerDiff(ctx context.Context, id string) ([]ContainerChange, error) {
+	diff, err := s.cli.ContainerDiff(ctx, id)
+	if err != nil {
+		return nil, clientError(err, id, fmt.Sprintf("Unable to diff container %s", ShortID(id)))
+	}
+
+	changes := []ContainerChange{}
+	for _, d := range diff {
+		kind, ok := changeKinds[d.Kind]
+		if !ok {
+			kind = strconv.Itoa(int(d.Kind))
+		}
+		changes = append(changes, ContainerChange{Path: d.Path, Kind: kind})
+	}
+
+	return changes, nil
+}
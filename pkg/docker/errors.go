@@ -0,0 +1,74 @@
+package docker
+
+import "fmt"
+
+// DockerClientError is returned when a call to the Docker daemon fails. ContainerID is set
+// when the call concerned a specific container.
+type DockerClientError struct {
+	Message       string
+	ContainerID   string
+	OriginalError error
+}
+
+func (e *DockerClientError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.OriginalError)
+}
+
+func (e *DockerClientError) Unwrap() error {
+	return e.OriginalError
+}
+
+// Cause allows errdefs and pkg/errors to see the underlying Docker error.
+func (e *DockerClientError) Cause() error {
+	return e.OriginalError
+}
+
+// ContainerCreateError is returned when a container can't be created for a deployment.
+// ContainerID is set if the container was created but couldn't be set up.
+type ContainerCreateError struct {
+	ContainerID    string
+	ContainerName  string
+	DeploymentName string
+	OriginalError  error
+}
+
+func (e *ContainerCreateError) Error() string {
+	if e.ContainerID != "" {
+		return fmt.Sprintf("Unable to create container %s (%s) for deployment %s: %s", e.ContainerName, ShortID(e.ContainerID), e.DeploymentName, e.OriginalError)
+	}
+	return fmt.Sprintf("Unable to create container %s for deployment %s: %s", e.ContainerName, e.DeploymentName, e.OriginalError)
+}
+
+func (e *ContainerCreateError) Unwrap() error {
+	return e.OriginalError
+}
+
+func (e *ContainerCreateError) Cause() error {
+	return e.OriginalError
+}
+
+// ContainerStartError is returned when a created container fails to start.
+type ContainerStartError struct {
+	ContainerID   string
+	OriginalError error
+}
+
+func (e *ContainerStartError) Error() string {
+	return fmt.Sprintf("Unable to start container %s: %s", ShortID(e.ContainerID), e.OriginalError)
+}
+
+func (e *ContainerStartError) Unwrap() error {
+	return e.OriginalError
+}
+
+func (e *ContainerStartError) Cause() error {
+	return e.OriginalError
+}
+
+func clientError(err error, containerID, message string) error {
+	return &DockerClientError{
+		Message:       message,
+		ContainerID:   containerID,
+		OriginalError: err,
+	}
+}
@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// unreachableClient returns a client for a daemon that refuses connections.
+func unreachableClient(t *testing.T) Client {
+	t.Helper()
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:1")
+
+	cli, err := NewClient(ClientConfig{})
+	if err != nil {
+		t.Fatalf("unable to create client: %s", err)
+	}
+
+	return cli
+}
+
+func TestDockerClientErrorAs(t *testing.T) {
+	_, err := unreachableClient(t).ContainerDetails("0123456789abcdef")
+
+	var clientErr *DockerClientError
+	if !errors.As(fmt.Errorf("wrapped: %w", err), &clientErr) {
+		t.Fatalf("expected DockerClientError, got %T: %s", err, err)
+	}
+	if clientErr.ContainerID != "0123456789abcdef" || clientErr.OriginalError == nil {
+		t.Errorf("unexpected fields %+v", clientErr)
+	}
+	if !IsConnectionFailed(clientErr.OriginalError) {
+		t.Errorf("expected the original error to be kept, got %s", clientErr.OriginalError)
+	}
+}
+
+func TestContainerStartErrorAs(t *testing.T) {
+	err := unreachableClient(t).StartContainer("0123456789abcdef")
+
+	var startErr *ContainerStartError
+	if !errors.As(err, &startErr) {
+		t.Fatalf("expected ContainerStartError, got %T: %s", err, err)
+	}
+	if startErr.ContainerID != "0123456789abcdef" || startErr.OriginalError == nil {
+		t.Errorf("unexpected fields %+v", startErr)
+	}
+}
+
+func TestContainerCreateErrorAs(t *testing.T) {
+	_, err := unreachableClient(t).CreateContainer(ContainerOptions{
+		Name:       "test-1",
+		Image:      "php:fpm",
+		Deployment: "test",
+		Platform:   "not a platform",
+	})
+
+	var createErr *ContainerCreateError
+	if !errors.As(err, &createErr) {
+		t.Fatalf("expected ContainerCreateError, got %T: %s", err, err)
+	}
+	if createErr.ContainerName != "test-1" || createErr.DeploymentName != "test" || createErr.ContainerID != "" {
+		t.Errorf("unexpected fields %+v", createErr)
+	}
+
+	var clientErr *DockerClientError
+	if !errors.As(err, &clientErr) {
+		t.Error("expected the cause to be a DockerClientError")
+	}
+}
@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"time"
+)
+
+// ContainerEvent is a lifecycle event of a container, e.g. die, oom or kill.
+type ContainerEvent struct {
+	Type        string
+	ContainerID string
+	Timestamp   time.Time
+}
+
+// SubscribeEvents streams the container events of the deployment until ctx is cancelled or
+// the connection to the daemon is lost, after which the channel is closed.
+func (s Client) SubscribeEvents(ctx context.Context, deployment string) (<-chan ContainerEvent, error) {
+	messages, errs := s.cli.Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", events.ContainerEventType),
+			filters.Arg("label", fmt.Sprintf("%s=%s", DeploymentLabel, deployment)),
+		),
+	})
+
+	return s.forwardEvents(ctx, messages, errs, func(msg events.Message) ContainerEvent {
+		return ContainerEvent{
+			Type:        msg.Action,
+			ContainerID: msg.Actor.ID,
+			Timestamp:   time.Unix(0, msg.TimeNano),
+		}
+	}, deployment), nil
+}
+
+// forwardEvents converts the Docker event messages until the stream ends. Source is only
+// used for logging.
+func (s Client) forwardEvents(ctx context.Context, messages <-chan events.Message, errs <-chan error, convert func(events.Message) ContainerEvent, source string) <-chan ContainerEvent {
+	out := make(chan ContainerEvent)
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case msg := <-messages:
+				select {
+				case out <- convert(msg):
+				case <-ctx.Done():
+					return
+				}
+			case err := <-errs:
+				if err != nil && ctx.Err() == nil {
+					s.config.Logger.WarnContext(ctx, "event stream ended", "source", source, "error", err)
+				}
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// SubscribeNetworkEvents streams connect and disconnect events of the network like
+// SubscribeEvents. The event's ContainerID is the container connected or disconnected.
+func (s Client) SubscribeNetworkEvents(ctx context.Context, network string) (<-chan ContainerEvent, error) {
+	messages, errs := s.cli.Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", events.NetworkEventType),
+			filters.Arg("network", network),
+			filters.Arg("event", "connect"),
+			filters.Arg("event", "disconnect"),
+		),
+	})
+
+	return s.forwardEvents(ctx, messages, errs, func(msg events.Message) ContainerEvent {
+		return ContainerEvent{
+			Type:        msg.Action,
+			ContainerID: msg.Actor.Attributes["container"],
+			Timestamp:   time.Unix(0, msg.TimeNano),
+		}
+	}, network), nil
+}
@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"time"
+)
+
+type ImageInfo struct {
+	ID           string
+	ExposedPorts []int
+	Labels       map[string]string
+	Architecture string
+}
+
+// ImageSummary describes a locally available image.
+type ImageSummary struct {
+	ID       string
+	RepoTags []string
+	Created  time.Time
+	Size     int64
+}
+
+// ImageLayer is a single entry of an image's history, newest first.
+type ImageLayer struct {
+	ID        string
+	Created   time.Time
+	CreatedBy string
+	Size      int64
+}
+
+// TagImage adds the target reference (e.g. cache/myapp:latest) to the source image.
+func (s Client) TagImage(ctx context.Context, source, target string) error {
+	if err := s.cli.ImageTag(ctx, source, target); err != nil {
+		return clientError(err, "", fmt.Sprintf("Unable to tag image %s as %s", source, target))
+	}
+
+	return nil
+}
+
+func (s Client) InspectImage(ctx context.Context, image, tag string) (ImageInfo, error) {
+	ref := fmt.Sprintf("%s:%s", image, tag)
+	inspect, _, err := s.cli.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return ImageInfo{}, clientError(err, "", fmt.Sprintf("Unable to inspect image %s", ref))
+	}
+
+	info := ImageInfo{
+		ID:           inspect.ID,
+		ExposedPorts: []int{},
+		Labels:       map[string]string{},
+		Architecture: inspect.Architecture,
+	}
+
+	if inspect.Config != nil {
+		for port := range inspect.Config.ExposedPorts {
+			info.ExposedPorts = append(info.ExposedPorts, port.Int())
+		}
+		if inspect.Config.Labels != nil {
+			info.Labels = inspect.Config.Labels
+		}
+	}
+
+	return info, nil
+}
+
+// ImageHistory lists the layers the image was built from.
+func (s Client) ImageHistory(ctx context.Context, image, tag string) ([]ImageLayer, error) {
+	ref := fmt.Sprintf("%s:%s", image, tag)
+	history, err := s.cli.ImageHistory(ctx, ref)
+	if err != nil {
+		return nil, clientError(err, "", fmt.Sprintf("Unable to fetch history for image %s", ref))
+	}
+
+	layers := []ImageLayer{}
+	for _, item := range history {
+		layers = append(layers, ImageLayer{
+			ID:        item.ID,
+			Created:   time.Unix(item.Created, 0),
+			CreatedBy: item.CreatedBy,
+			Size:      item.Size,
+		})
+	}
+
+	return layers, nil
+}
+
+// ListImages lists local images matching the reference filter, e.g. myapp or myapp:1.2.
+// An empty filter lists all images.
+func (s Client) ListImages(ctx context.Context, filter string) ([]ImageSummary, error) {
+	opts := types.ImageListOptions{}
+	if filter != "" {
+		opts.Filters = filters.NewArgs(filters.Arg("reference", filter))
+	}
+
+	list, err := s.cli.ImageList(ctx, opts)
+	if err != nil {
+		return nil, clientError(err, "", fmt.Sprintf("Unable to list images matching %s", filter))
+	}
+
+	images := []ImageSummary{}
+	for _, img := range list {
+		images = append(images, ImageSummary{
+			ID:       img.ID,
+			RepoTags: img.RepoTags,
+			Created:  time.Unix(img.Created, 0),
+			Size:     img.Size,
+		})
+	}
+
+	return images, nil
+}
+
+// ImageExists tells if the image is available locally.
+func (s Client) ImageExists(ctx context.Context, image, tag string) (bool, error) {
+	images, err := s.ListImages(ctx, fmt.Sprintf("%s:%s", image, tag))
+	if err != nil {
+		return false, err
+	}
+
+	return len(images) > 0, nil
+}
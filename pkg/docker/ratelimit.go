@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"github.com/docker/docker/client"
+	"golang.org/x/time/rate"
+	"net/http"
+)
+
+// rateLimitedTransport waits for the limiter before every Docker API call.
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// withLimiter wraps the transport of the Docker client, so it has to come after the options
+// configuring the transport.
+func withLimiter(limiter *rate.Limiter) client.Opt {
+	return func(c *client.Client) error {
+		hc := c.HTTPClient()
+		base := hc.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		hc.Transport = &rateLimitedTransport{base: base, limiter: limiter}
+
+		return client.WithHTTPClient(hc)(c)
+	}
+}
+
+// SetLimiter limits the Docker API calls of the client with the given limiter, which can be
+// shared between clients. The transport of the client is wrapped in place, so copies of the
+// client are limited too. It's not safe to call while the client is in use.
+func (s Client) SetLimiter(limiter *rate.Limiter) error {
+	if limited, ok := s.cli.HTTPClient().Transport.(*rateLimitedTransport); ok {
+		limited.limiter = limiter
+		return nil
+	}
+
+	if err := withLimiter(limiter)(s.cli); err != nil {
+		return clientError(err, "", "Unable to limit Docker API calls")
+	}
+
+	return nil
+}
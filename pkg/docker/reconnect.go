@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/client"
+	"time"
+)
+
+// IsConnectionFailed tells if the error was caused by the Docker daemon being unreachable,
+// e.g. while it's restarting.
+func IsConnectionFailed(err error) bool {
+	return client.IsErrConnectionFailed(err)
+}
+
+// Ping checks that the Docker daemon responds.
+func (s Client) Ping(ctx context.Context) error {
+	if _, err := s.cli.Ping(ctx); err != nil {
+		return clientError(err, "", "Unable to reach Docker daemon")
+	}
+
+	return nil
+}
+
+// Close releases the connections of the client to the Docker daemon.
+func (s Client) Close() error {
+	return s.cli.Close()
+}
+
+// Reconnect waits for the Docker daemon to respond again. The daemon is tried
+// ReconnectMaxAttempts times, ReconnectDelayMs apart. The client stays the same, as it's
+// shared by goroutines still using it: only its idle connections to the daemon are dropped,
+// and new ones dialled as needed.
+func (s Client) Reconnect(ctx context.Context) error {
+	attempts := s.config.ReconnectMaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := time.Duration(s.config.ReconnectDelayMs) * time.Millisecond
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		s.cli.HTTPClient().CloseIdleConnections()
+		if err = s.Ping(ctx); err != nil {
+			continue
+		}
+
+		s.config.Logger.InfoContext(ctx, "reconnected to Docker daemon", "attempts", attempt+1)
+		return nil
+	}
+
+	return clientError(err, "", fmt.Sprintf("Unable to reconnect to Docker daemon after %d attempts", attempts))
+}
@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"math/rand"
+	"time"
+)
+
+const retryBaseDelay = 250 * time.Millisecond
+
+// withRetry runs fn until it succeeds, fails with an error that is not worth retrying
+// or RetryMaxAttempts has been reached. Delay between attempts grows exponentially with jitter.
+func (s Client) withRetry(fn func() error) error {
+	attempts := s.config.RetryMaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := retryBaseDelay * time.Duration(1<<uint(attempt-1))
+			time.Sleep(delay + time.Duration(rand.Int63n(int64(delay/2))))
+		}
+
+		if err = fn(); err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// Only connection problems and daemon side failures are retried. Errors like a missing
+// image or a name conflict will not go away by trying again.
+func isRetryable(err error) bool {
+	return client.IsErrConnectionFailed(err) || errdefs.IsSystem(err) || errdefs.IsUnavailable(err)
+}
@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"net"
+)
+
+type ServiceOptions struct {
+	Name       string
+	Image      string
+	Deployment string
+	Labels     map[string]string
+	Replicas   int
+	// Existing overlay network the service is attached to. Optional.
+	Network string
+	// Port published through the swarm ingress network to a port chosen by Docker
+	Port int
+	Auth AuthConfig
+}
+
+// ServiceEndpoint tells how a swarm service can be reached.
+type ServiceEndpoint struct {
+	// Virtual IP of the service in the network it was attached to, if any
+	VIP string
+	// Port the service's target port is published to on every swarm node
+	PublishedPort int
+}
+
+// CreateService creates a replicated swarm service for the deployment.
+func (s Client) CreateService(ctx context.Context, opts ServiceOptions) (string, error) {
+	s.config.Logger.DebugContext(ctx, "creating service", "name", opts.Name, "image", opts.Image, "deployment", opts.Deployment)
+
+	labels := map[string]string{
+		OrchestratorLabel: orchestratorName,
+		DeploymentLabel:   opts.Deployment,
+	}
+	for k, v := range opts.Labels {
+		if IsReservedLabel(k) {
+			return "", &DockerClientError{Message: fmt.Sprintf("Label %s is reserved for docker-fpm", k)}
+		}
+		labels[k] = v
+	}
+
+	replicas := uint64(opts.Replicas)
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name:   opts.Name,
+			Labels: labels,
+		},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image:  opts.Image,
+				Labels: labels,
+			},
+		},
+		Mode: swarm.ServiceMode{
+			Replicated: &swarm.ReplicatedService{Replicas: &replicas},
+		},
+		EndpointSpec: &swarm.EndpointSpec{
+			Mode: swarm.ResolutionModeVIP,
+			Ports: []swarm.PortConfig{{
+				Protocol:    swarm.PortConfigProtocolTCP,
+				TargetPort:  uint32(opts.Port),
+				PublishMode: swarm.PortConfigPublishModeIngress,
+			}},
+		},
+	}
+	if opts.Network != "" {
+		spec.TaskTemplate.Networks = []swarm.NetworkAttachmentConfig{{Target: opts.Network}}
+	}
+
+	encodedAuth, err := opts.Auth.encode()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := s.cli.ServiceCreate(ctx, spec, types.ServiceCreateOptions{EncodedRegistryAuth: encodedAuth})
+	if err != nil {
+		return "", clientError(err, "", fmt.Sprintf("Unable to create service %s", opts.Name))
+	}
+
+	for _, warn := range res.Warnings {
+		s.config.Logger.WarnContext(ctx, "warning for created service", "name", opts.Name, "warning", warn)
+	}
+
+	return res.ID, nil
+}
+
+// ServiceEndpoint returns the VIP of the service in the given network (if any) and the port
+// its target port is published to. Both are empty until Docker has allocated them.
+func (s Client) ServiceEndpoint(ctx context.Context, id, network string, targetPort int) (ServiceEndpoint, error) {
+	svc, _, err := s.cli.ServiceInspectWithRaw(ctx, id, types.ServiceInspectOptions{})
+	if err != nil {
+		return ServiceEndpoint{}, clientError(err, "", fmt.Sprintf("Unable to inspect service %s", ShortID(id)))
+	}
+
+	endpoint := ServiceEndpoint{}
+	for _, port := range svc.Endpoint.Ports {
+		if port.TargetPort == uint32(targetPort) {
+			endpoint.PublishedPort = int(port.PublishedPort)
+		}
+	}
+
+	if network != "" {
+		nw, err := s.cli.NetworkInspect(ctx, network, types.NetworkInspectOptions{})
+		if err != nil {
+			return ServiceEndpoint{}, clientError(err, "", fmt.Sprintf("Unable to inspect network %s", network))
+		}
+		for _, vip := range svc.Endpoint.VirtualIPs {
+			if vip.NetworkID != nw.ID {
+				continue
+			}
+			if ip, _, err := net.ParseCIDR(vip.Addr); err == nil {
+				endpoint.VIP = ip.String()
+			}
+		}
+	}
+
+	return endpoint, nil
+}
+
+func (s Client) RemoveService(ctx context.Context, id string) error {
+	s.config.Logger.DebugContext(ctx, "removing service", "id", ShortID(id))
+
+	if err := s.cli.ServiceRemove(ctx, id); err != nil {
+		return clientError(err, "", fmt.Sprintf("Unable to remove service %s", ShortID(id)))
+	}
+
+	return nil
+}
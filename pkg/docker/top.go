@@ -0,0 +1,60 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// topArgs makes ps report the elapsed time in seconds along with resource usage.
+var topArgs = []string{"-o", "pid,etimes,pcpu,pmem,args"}
+
+// ProcessInfo describes a process running in a container.
+type ProcessInfo struct {
+	PID            int
+	Command        string
+	CPUPercent     float64
+	MemPercent     float64
+	ElapsedSeconds int
+}
+
+// ContainerTopProcesses lists the processes running in the container.
+func (s Client) ContainerTopProcesses(ctx context.Context, id string) ([]ProcessInfo, error) {
+	top, err := s.cli.ContainerTop(ctx, id, topArgs)
+	if err != nil {
+		return nil, clientError(err, id, fmt.Sprintf("Unable to list processes of container %s", ShortID(id)))
+	}
+
+	columns := map[string]int{}
+	for i, title := range top.Titles {
+		columns[title] = i
+	}
+	field := func(row []string, title string) string {
+		if i, ok := columns[title]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	processes := []ProcessInfo{}
+	for _, row := range top.Processes {
+		pid, err := strconv.Atoi(field(row, "PID"))
+		if err != nil {
+			continue
+		}
+		cpu, _ := strconv.ParseFloat(field(row, "%CPU"), 64)
+		mem, _ := strconv.ParseFloat(field(row, "%MEM"), 64)
+		elapsed, _ := strconv.Atoi(field(row, "ELAPSED"))
+
+		processes = append(processes, ProcessInfo{
+			PID:            pid,
+			Command:        strings.TrimSpace(field(row, "COMMAND")),
+			CPUPercent:     cpu,
+			MemPercent:     mem,
+			ElapsedSeconds: elapsed,
+		})
+	}
+
+	return processes, nil
+}
@@ -0,0 +1,104 @@
+package fpm
+
+import (
+	"github.com/pkg/errors"
+	"hash/fnv"
+	"net"
+	"net/http"
+)
+
+// sessionCookie is used for affinity when the hashed header is Cookie, instead of the whole header.
+const sessionCookie = "PHPSESSID"
+
+// HashHeaderStrategy routes requests by the FNV-1a hash of a header's value, so that requests
+// of a session end up in the same container as long as it's available. For Cookie, the
+// PHPSESSID cookie is used, as other cookies may change between requests. Requests without
+// the header are routed randomly.
+type HashHeaderStrategy struct {
+	Header string
+}
+
+func (h HashHeaderStrategy) Select(containers []*Container, r *http.Request) (*Container, error) {
+	key := h.key(r)
+	if key == "" {
+		return RandomStrategy{}.Select(containers, r)
+	}
+
+	return hashedContainer(containers, key)
+}
+
+func (h HashHeaderStrategy) preferred(containers []*Container, r *http.Request) *Container {
+	return hashedHome(containers, h.key(r))
+}
+
+func (h HashHeaderStrategy) key(r *http.Request) string {
+	key := r.Header.Get(h.Header)
+	if http.CanonicalHeaderKey(h.Header) == "Cookie" {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			key = cookie.Value
+		}
+	}
+
+	return key
+}
+
+// StickyIPStrategy routes requests from the same client address to the same container as
+// long as it's available.
+type StickyIPStrategy struct{}
+
+func (StickyIPStrategy) Select(containers []*Container, r *http.Request) (*Container, error) {
+	return hashedContainer(containers, clientIP(r))
+}
+
+func (StickyIPStrategy) preferred(containers []*Container, r *http.Request) *Container {
+	return hashedHome(containers, clientIP(r))
+}
+
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
+
+// affinityStrategy is implemented by the strategies routing each client to a container of its
+// own, so that the controller can tell when a request had to be routed elsewhere.
+type affinityStrategy interface {
+	// preferred returns the container the request is routed to when it's available, or nil.
+	preferred(containers []*Container, r *http.Request) *Container
+}
+
+// hashIndex returns the position of key's container in a pool of amount containers.
+func hashIndex(key string, amount int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(amount))
+}
+
+// hashedHome returns the container of key regardless of its availability.
+func hashedHome(containers []*Container, key string) *Container {
+	if key == "" || len(containers) == 0 {
+		return nil
+	}
+
+	return containers[hashIndex(key, len(containers))]
+}
+
+// hashedContainer selects a container by the FNV-1a hash of key. If that container isn't
+// available, the next available one is used instead, so affinity is best-effort only.
+func hashedContainer(containers []*Container, key string) (*Container, error) {
+	amount := len(containers)
+	if amount == 0 {
+		return nil, errors.New("No configured containers to choose from")
+	}
+
+	index := hashIndex(key, amount)
+	for i := 0; i < amount; i++ {
+		if candidate := containers[(index+i)%amount]; candidate.Available() {
+			return candidate, nil
+		}
+	}
+
+	return nil, errors.New("All containers are either shut down, marked as dirty or have their circuit open")
+}
@@ -0,0 +1,41 @@
+package fpm
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAffinityReroutingIsLogged(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	var logs bytes.Buffer
+	s := newTestController(t, backend, func(conf *ControllerConfig) {
+		conf.Strategy = StickyIPStrategy{}
+		conf.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	})
+	s.Lock.Lock()
+	s.pool.Add(&Container{Name: "other", Id: "other", Started: true, IPAddr: "127.0.0.1"})
+	s.syncContainers()
+	s.Lock.Unlock()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	home := StickyIPStrategy{}.preferred(s.pool.Members(), r)
+	s.ServeHTTP(httptest.NewRecorder(), r)
+	if logs.Len() > 0 {
+		t.Fatalf("expected nothing to be logged while the preferred container is available, got:\n%s", logs.String())
+	}
+
+	s.Lock.Lock()
+	home.Dirty = true
+	s.Lock.Unlock()
+	s.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !strings.Contains(logs.String(), "routing session to another one") || !strings.Contains(logs.String(), "deployment=test") || !strings.Contains(logs.String(), "name="+home.Name) {
+		t.Errorf("expected the rerouting to be logged with the deployment, got:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,114 @@
+package fpm
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// InitAsync initializes the deployment in the background. The returned channel receives nil once
+// MinContainers containers are ready, or the error that stopped the initialization before that.
+// The rest of the pool is added one container at a time afterwards, while requests are served.
+func (s *ReqController) InitAsync() (<-chan error, error) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if s.ready != nil || s.pool.Len() > 0 {
+		return nil, errors.New(fmt.Sprintf("Deployment %s has already been initialized", s.Config.Deployment))
+	}
+
+	s.ready = make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		err := s.initMinimum()
+		s.readyErr = err
+		close(s.ready)
+		result <- err
+	}()
+
+	return result, nil
+}
+
+// WaitUntilReady blocks until InitAsync has brought MinContainers containers up, returning
+// the initialization error if it failed, or the context's error if ctx ends first.
+func (s *ReqController) WaitUntilReady(ctx context.Context) error {
+	s.Lock.RLock()
+	ready := s.ready
+	s.Lock.RUnlock()
+
+	if ready == nil {
+		return errors.New(fmt.Sprintf("Deployment %s is not being initialized asynchronously", s.Config.Deployment))
+	}
+
+	select {
+	case <-ready:
+		return s.readyErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// initMinimum initializes the deployment with MinContainers containers and starts filling
+// the rest of the pool in the background.
+func (s *ReqController) initMinimum() error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	amount := s.Config.MinContainers
+	if amount == 0 {
+		amount = s.Config.ContainerAmount
+	}
+	if err := s.initialize(amount); err != nil {
+		return err
+	}
+
+	if s.pool.Len() < s.Config.ContainerAmount {
+		s.background.Add(1)
+		go s.fillPool(s.stop)
+	}
+
+	return nil
+}
+
+// fillPool adds containers until the pool is full or the controller is closed. The lock is
+// released between containers, so that requests can be served by the ready ones.
+func (s *ReqController) fillPool(stop chan struct{}) {
+	defer s.background.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		full, err := s.addContainer()
+		if err != nil {
+			s.logger().Error("unable to add containers", "deployment", s.Config.Deployment, "error", err)
+			return
+		}
+		if full {
+			return
+		}
+	}
+}
+
+func (s *ReqController) addContainer() (bool, error) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if s.pool.Len() >= s.Config.ContainerAmount || s.Config.swarmMode() {
+		return true, nil
+	}
+
+	if err := s.createNewContainer(); err != nil {
+		return false, err
+	}
+	if s.Config.startsImmediately() {
+		if err := s.startContainers(); err != nil {
+			return false, err
+		}
+	}
+
+	return s.pool.Len() >= s.Config.ContainerAmount, nil
+}
@@ -0,0 +1,55 @@
+package fpm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+func (c *Container) ID() string {
+	return c.Id
+}
+
+// Available tells if the container can be selected for serving requests.
+func (c *Container) Available() bool {
+	return c.Started && !c.Dirty && !c.Paused && !c.CircuitOpen()
+}
+
+// Acquire counts a request routed to the container.
+func (c *Container) Acquire() {
+	atomic.AddInt64(&c.ActiveReqs, 1)
+	atomic.AddInt64(&c.RequestCount, 1)
+}
+
+// Release marks a request to the container done.
+func (c *Container) Release() {
+	atomic.AddInt64(&c.ActiveReqs, -1)
+}
+
+// CircuitOpen tells if the container's circuit breaker has tripped and its cooldown is still ongoing.
+func (c *Container) CircuitOpen() bool {
+	return time.Now().UnixNano() < atomic.LoadInt64(&c.circuitOpenUntil)
+}
+
+// recordProxyError handles a failed request to the container. With the container circuit
+// breaker enabled, enough consecutive errors open the circuit for the cooldown period.
+// Otherwise the container is marked dirty right away.
+func (s *ReqController) recordProxyError(c *Container) {
+	threshold := s.Config.ContainerCircuitBreakerThreshold
+	if threshold <= 0 {
+		s.setContainerDirty(c.Id)
+		return
+	}
+
+	if atomic.AddInt64(&c.consecutiveErrors, 1) < int64(threshold) {
+		return
+	}
+
+	cooldown := time.Duration(s.Config.ContainerCircuitBreakerCooldownMs) * time.Millisecond
+	atomic.StoreInt64(&c.circuitOpenUntil, time.Now().Add(cooldown).UnixNano())
+	atomic.StoreInt64(&c.consecutiveErrors, 0)
+	s.logger().Warn("circuit breaker opened", "deployment", s.Config.Deployment, "name", c.Name, "errors", threshold)
+}
+
+func (s *ReqController) recordProxySuccess(c *Container) {
+	atomic.StoreInt64(&c.consecutiveErrors, 0)
+}
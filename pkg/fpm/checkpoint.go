@@ -0,0 +1,26 @@
+//go:build criu
+
+package fpm
+
+import "context"
+
+// CheckpointAll checkpoints every started container to checkpointDir, using the container
+// name as the checkpoint ID. The lock is held for the duration, so no new requests are routed
+// to the pool while it's being snapshotted.
+func (s *ReqController) CheckpointAll(checkpointDir string) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	cli := s.DockerCli.WithCheckpointDir(checkpointDir)
+	for _, c := range s.pool.Members() {
+		if !c.Started {
+			continue
+		}
+
+		if err := cli.CheckpointContainer(context.Background(), c.Id, c.Name); err != nil {
+			return s.deploymentError(err, "Unable to checkpoint deployment %s", s.Config.Deployment)
+		}
+	}
+
+	return nil
+}
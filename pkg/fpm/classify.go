@@ -0,0 +1,58 @@
+package fpm
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// ErrorClass tells how a failed request to a container is handled.
+type ErrorClass int
+
+const (
+	// The container is likely broken, e.g. crashed. It's marked dirty (or counted by the
+	// circuit breaker) and 502 is returned.
+	ErrorClassContainer ErrorClass = iota
+	// The container is likely overloaded. It's left alone and 504 is returned.
+	ErrorClassTimeout
+	// The request failed because of a configuration problem, e.g. DNS or TLS. The container
+	// is left alone and 500 is returned.
+	ErrorClassConfig
+)
+
+// DefaultErrorClassifier classifies refused and reset connections as container failures,
+// timeouts as overload and everything else as configuration problems.
+func DefaultErrorClassifier(err error) ErrorClass {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorClassContainer
+	}
+
+	var netErr net.Error
+	if errors.Is(err, syscall.ETIMEDOUT) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrorClassTimeout
+	}
+
+	return ErrorClassConfig
+}
+
+// classifyProxyError handles a failed request to the container according to the configured
+// ErrorClassifier, returning the status to respond with.
+func (s *ReqController) classifyProxyError(c *Container, err error) int {
+	classify := s.Config.ErrorClassifier
+	if classify == nil {
+		classify = DefaultErrorClassifier
+	}
+
+	switch classify(err) {
+	case ErrorClassTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorClassConfig:
+		return http.StatusInternalServerError
+	default:
+		s.recordProxyError(c)
+		return http.StatusBadGateway
+	}
+}
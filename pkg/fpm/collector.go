@@ -0,0 +1,95 @@
+package fpm
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync/atomic"
+)
+
+var (
+	containersDesc = prometheus.NewDesc(
+		"fpm_containers",
+		"Containers of the deployment by state.",
+		[]string{"deployment", "state"}, nil,
+	)
+	deploymentPausedDesc = prometheus.NewDesc(
+		"fpm_deployment_paused",
+		"Whether the deployment is paused (1) or serving requests (0).",
+		[]string{"deployment"}, nil,
+	)
+	activeRequestsDesc = prometheus.NewDesc(
+		"fpm_container_active_requests",
+		"Requests currently being proxied to the container.",
+		[]string{"deployment", "container"}, nil,
+	)
+	requestsDesc = prometheus.NewDesc(
+		"fpm_container_requests_total",
+		"Requests routed to the container.",
+		[]string{"deployment", "container"}, nil,
+	)
+	healthRatioDesc = prometheus.NewDesc(
+		"fpm_pool_health_ratio",
+		"Share of the deployment's containers that are started and not dirty.",
+		[]string{"deployment"}, nil,
+	)
+	networkRxDesc = prometheus.NewDesc(
+		"fpm_container_network_rx_bytes_total",
+		"Bytes received by the container, as of the last health sync.",
+		[]string{"deployment", "container"}, nil,
+	)
+	networkTxDesc = prometheus.NewDesc(
+		"fpm_container_network_tx_bytes_total",
+		"Bytes sent by the container, as of the last health sync.",
+		[]string{"deployment", "container"}, nil,
+	)
+)
+
+// Describe implements prometheus.Collector, so that the controller can be registered to
+// a registry with prometheus.MustRegister(controller).
+func (s *ReqController) Describe(ch chan<- *prometheus.Desc) {
+	ch <- containersDesc
+	ch <- deploymentPausedDesc
+	ch <- activeRequestsDesc
+	ch <- requestsDesc
+	ch <- healthRatioDesc
+	ch <- networkRxDesc
+	ch <- networkTxDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *ReqController) Collect(ch chan<- prometheus.Metric) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	deployment := s.Config.Deployment
+	started, dirty, paused := 0, 0, 0
+	for _, c := range s.pool.Members() {
+		if c.Started {
+			started++
+		}
+		if c.Dirty {
+			dirty++
+		}
+		if c.Paused {
+			paused++
+		}
+
+		ch <- prometheus.MustNewConstMetric(activeRequestsDesc, prometheus.GaugeValue, float64(atomic.LoadInt64(&c.ActiveReqs)), deployment, c.Name)
+		ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&c.RequestCount)), deployment, c.Name)
+		if s.Config.NetworkStatsOnSync {
+			ch <- prometheus.MustNewConstMetric(networkRxDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&c.NetRxBytes)), deployment, c.Name)
+			ch <- prometheus.MustNewConstMetric(networkTxDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&c.NetTxBytes)), deployment, c.Name)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(containersDesc, prometheus.GaugeValue, float64(s.pool.Len()), deployment, "total")
+	ch <- prometheus.MustNewConstMetric(containersDesc, prometheus.GaugeValue, float64(started), deployment, "started")
+	ch <- prometheus.MustNewConstMetric(containersDesc, prometheus.GaugeValue, float64(dirty), deployment, "dirty")
+	ch <- prometheus.MustNewConstMetric(containersDesc, prometheus.GaugeValue, float64(paused), deployment, "paused")
+	ch <- prometheus.MustNewConstMetric(healthRatioDesc, prometheus.GaugeValue, s.healthRatio(), deployment)
+
+	pausedValue := 0.0
+	if s.IsPaused() {
+		pausedValue = 1
+	}
+	ch <- prometheus.MustNewConstMetric(deploymentPausedDesc, prometheus.GaugeValue, pausedValue, deployment)
+}
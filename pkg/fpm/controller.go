@@ -1,29 +1,251 @@
 package fpm
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/tls"
+	stderrors "errors"
 	"fmt"
 	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"github.com/ajmyyra/docker-fpm/pkg/fpm/middleware"
+	"github.com/ajmyyra/docker-fpm/pkg/fpm/pool"
+	"github.com/ajmyyra/docker-fpm/pkg/webhook"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
 	"github.com/pkg/errors"
 	"io"
+	"io/ioutil"
+	"log/slog"
 	"math/rand"
+	"net"
 	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const DynamicController = "dynamic"
 const StaticController = "static"
 
-var controllerTypes = []string{DynamicController, StaticController}
+// FailoverController starts its containers like StaticController, but when none of them is
+// available, requests are served by a fallback pool of FallbackImage instead.
+const FailoverController = "failover"
+
+var controllerTypes = []string{DynamicController, StaticController, FailoverController}
+
+// Container names accepted by Docker
+var validContainerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+const containerWaitTimeout = 30 * time.Second
+const drainPollInterval = 100 * time.Millisecond
+const startupLogLines = 50
 
 type ControllerConfig struct {
 	Deployment        string
 	ContainerImage    string
 	ContainerImageTag string
-	ContainerPort     int
-	ContainerAmount   int
-	Type              string
-	DynIdleSeconds    int
+	// Deprecated: use ContainerPorts instead. Only used when ContainerPorts is empty.
+	ContainerPort int
+	// The first port is the primary FCGI port, the rest are exposed as ExtraPorts.
+	ContainerPorts          []int
+	ContainerAmount         int
+	Type                    string
+	DynIdleSeconds          int
+	ReadinessProbePort      int
+	ReadinessTimeoutSeconds int
+	// When not empty, only these HTTP methods are proxied to containers
+	AllowedMethods []string
+	// Headers set on every proxied response. Existing response headers are only
+	// replaced when OverrideExistingHeaders is set.
+	InjectResponseHeaders   map[string]string
+	OverrideExistingHeaders bool
+	// Request headers removed before the request is forwarded to a container
+	StripRequestHeaders []string
+	// Host header sent to containers. The original Host is preserved when empty.
+	OverrideHost string
+	// When set, containers are connected to over HTTPS using this config (e.g. for mTLS)
+	BackendTLSConfig *tls.Config
+	// Retry container creation and startup on transient Docker API errors
+	RetryDockerErrors      bool
+	DockerRetryMaxAttempts int
+	// How often container states are synced from Docker. Syncing is disabled when zero.
+	HealthSyncIntervalSeconds int
+	// Labels added to every container in addition to the ones used by docker-fpm
+	ExtraLabels map[string]string
+	// Pull the container image on Init, using RegistryAuth for private registries
+	AutoPull     bool
+	RegistryAuth docker.AuthConfig
+	// Network the containers are attached to. It has to exist already unless
+	// CreateNetworkIfMissing is set, in which case an isolated network with this name is
+	// created for the deployment. A created network is internal (no outbound traffic) unless
+	// NetworkAllowExternal is set.
+	NetworkName          string
+	NetworkAllowExternal bool
+	// Commands run in each container after it's ready but before it receives traffic
+	WarmupCommands [][]string
+	// Pause the deployment when this many containers are dirty at the same time. Zero disables.
+	MaxDirtyContainers int
+	// Consecutive proxy errors after which a container is taken out of rotation for the
+	// cooldown period instead of being marked dirty. Zero disables the circuit breaker.
+	ContainerCircuitBreakerThreshold  int
+	ContainerCircuitBreakerCooldownMs int
+	// How long in-flight requests are waited for before a stopping container is killed
+	DrainTimeoutSeconds int
+	// When no container is available, up to QueueDepth requests wait for one for at most
+	// QueueTimeoutSeconds. Requests are rejected right away when QueueDepth is zero.
+	QueueDepth          int
+	QueueTimeoutSeconds int
+	// Verify that started containers accept connections on their primary port
+	ValidateConnectivity bool
+	// Remove named volumes of the containers on Close
+	RemoveVolumes bool
+	// Speak HTTP/2 cleartext (h2c) to containers. Not supported by PHP-FPM itself, but
+	// by some other backends. With BackendTLSConfig, HTTP/2 is negotiated over TLS instead.
+	BackendH2C bool
+	// Settings for individual containers of the pool, e.g. one with a different image
+	PerContainerOverrides []ContainerOverride
+	// Include the container's latest output in startup errors
+	CaptureStartupLogs bool
+	// Route to containers by name using the deployment network's embedded DNS instead of
+	// by cached IP address. Requires NetworkName.
+	UseContainerAlias bool
+	// Upper limit for handling a request, including queueing and copying the response.
+	// Requests exceeding it are aborted with 504. Zero means no limit.
+	RequestTimeoutSeconds int
+	// Platform to run the containers on, e.g. linux/amd64 or linux/arm64. Empty leaves it to Docker.
+	Platform string
+	// Log a warning for containers running longer than this, without recycling them. Zero disables.
+	WarnContainerAgeMinutes int
+	// Logger for Docker container lifecycle events and the controller. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+	// Local reference (e.g. docker-fpm-cache/myapp:latest) the image is tagged with during Init.
+	// Containers are created from it, so they can be created even if the registry is unreachable.
+	LocalCacheTag string
+	// Containers that need to be ready before InitAsync reports the deployment ready.
+	// Zero means all of ContainerAmount.
+	MinContainers int
+	// Names the Nth container of the deployment. Defaults to <deployment>-<N>.
+	ContainerNameFunc func(deployment string, n int) string
+	// Subnet (CIDR) and gateway of the deployment network. Docker assigns them if empty.
+	// The subnet may not overlap with networks of other docker-fpm deployments.
+	NetworkSubnet  string
+	NetworkGateway string
+	// Decides how failed requests to containers are handled. Defaults to DefaultErrorClassifier.
+	ErrorClassifier func(err error) ErrorClass
+	// Minimum delay between container creations, to avoid overloading the Docker daemon.
+	ContainerCreateDelayMs int
+	// Publish container ports to random host ports and route through them on localhost instead
+	// of container IPs.
+	UseHostPorts bool
+	// URL to POST container lifecycle events to, signed with WebhookSecret
+	WebhookURL    string
+	WebhookSecret string
+	// Either ContainerBackend (default) for standalone containers or SwarmServiceBackend for
+	// a replicated swarm service of ContainerAmount replicas. In swarm mode NetworkName has to
+	// be an existing overlay network, as it's not created by docker-fpm.
+	BackendMode string
+	// Deployments that a Server initializes before this one
+	DependsOn []string
+	// After a failed start of a dynamic deployment, requests within this period fail right
+	// away instead of retrying the start.
+	StartupBackoffMs int
+	// Keep container stdin open, so that it can be attached to for debugging
+	AttachStdin bool
+	// Route requests by the FNV-1a hash of this header's value, so that requests of a session
+	// end up in the same container as long as it's available. For Cookie, the PHPSESSID cookie
+	// is used. This is best-effort affinity: sessions move when their container is replaced.
+	// Shorthand for HashHeaderStrategy, ignored when Strategy is set.
+	HashHeader string
+	// tmpfs mounts for the containers, e.g. {"/tmp": "size=100m,mode=1777"}. Keys are absolute
+	// container paths and values comma-separated mount options.
+	TmpfsMounts map[string]string
+	// Create NetworkName on Init if it doesn't exist, and remove it on Close. Earlier versions
+	// always created the network, so configurations relying on that have to set this, or Init
+	// fails on the missing network. DefaultConfig sets it.
+	CreateNetworkIfMissing bool
+	// Path prefix removed from requests before they're proxied, for applications served at a
+	// sub-path but configured for the root. Requests outside the prefix get 404.
+	StripURIPrefix string
+	// Probe containers reported dirty before recreating them, and return the ones that recover
+	// to the pool. Probing is retried DirtyRevalidationAttempts times with growing intervals.
+	RevalidateDirtyContainers bool
+	DirtyRevalidationAttempts int
+	// When the health sync finds the Docker daemon unreachable, reconnect to it this many
+	// times, DockerReconnectDelayMs apart, and reconcile the containers once it responds.
+	// Reconnecting is disabled when zero.
+	DockerReconnectMaxAttempts int
+	DockerReconnectDelayMs     int
+	// Chooses the container for each request. Random selection is used when nil.
+	Strategy SelectionStrategy
+	// Report filesystem changes of the running containers on every health sync, e.g. to notice
+	// uploaded code or modified configuration. Each change is logged at debug level once, the
+	// first time it's seen. Requires HealthSyncIntervalSeconds.
+	AuditFilesystemOnSync bool
+	// Image of the fallback pool used by failover deployments, e.g. a maintenance page. The
+	// tag defaults to latest.
+	FallbackImage string
+	FallbackTag   string
+	// Maps requests to FCGI parameters passed to the containers as headers, with underscores
+	// replaced by dashes (CONTENT_TYPE is sent as Content-Type). Useful when docker-fpm is the
+	// only gateway in front of the containers. DefaultFCGIParamMapper follows CGI/1.1.
+	FCGIParamMapper func(r *http.Request) map[string]string
+	// Copied from dirty containers to a directory of CrashDumpDir before they're removed, e.g.
+	// /var/log/php-fpm/crash.log. Fetching is disabled unless both are set.
+	CrashDumpPath string
+	CrashDumpDir  string
+	// Fetch network traffic statistics of the containers on every health sync. Requires
+	// HealthSyncIntervalSeconds.
+	NetworkStatsOnSync bool
+	// Restart containers with PHP-FPM workers running longer than this on health sync. See
+	// DetectStuckProcesses for when worker age is meaningful. Zero disables.
+	StuckProcessMaxAgeSeconds int
+	// Requests from these networks have their remote address taken from X-Forwarded-For. The
+	// client address is passed to the containers in X-Real-IP and as REMOTE_ADDR with
+	// FCGIParamMapper.
+	TrustedProxyCIDRs []string
+	// Use the container name as its hostname and as a DNS alias in the deployment network,
+	// without routing requests by name like UseContainerAlias. Docker's embedded DNS resolves
+	// the names on user-defined networks, so containers can reach each other by name, e.g.
+	// new PDO("mysql:host=myapp-db;..."). Requires NetworkName.
+	SetContainerHostname bool
+	// Stop waiting for the rest of the containers to become ready as soon as one fails
+	FailFastOnReadiness bool
+	// Respond with 503 while the share of started, non-dirty containers is below this. Not
+	// applied while a dynamic deployment is stopped. Zero disables.
+	MinHealthRatio float64
+	// Log driver of the containers, e.g. fluentd with {"fluentd-address": "localhost:24224"}
+	// as options. Empty uses the Docker daemon default. CaptureStartupLogs needs a driver
+	// Docker can read logs back from, unless dual logging is enabled in the daemon.
+	LogDriver        string
+	LogDriverOptions map[string]string
+	// Attempts for pulling the image with AutoPull, PullBackoffMs times the attempt number
+	// apart. Values below 2 disable retrying.
+	PullMaxAttempts int
+	PullBackoffMs   int
+	// Answers OPTIONS requests in the controller and adds CORS headers to responses
+	CORSConfig *CORSConfig
+	// Requests from the same client repeating an ID in this header for the same method and
+	// path get the cached response of the first one for DeduplicateCacheTTLMs, instead of
+	// being processed again. Server errors and cookies aren't cached.
+	DeduplicateRequestIDHeader string
+	DeduplicateCacheTTLMs      int
+	// Containers restarted by Docker more times than this are recreated on health sync, as
+	// the restart policy hides crash loops. Requires HealthSyncIntervalSeconds, zero disables.
+	MaxRestartCount int
+	// Send the Content-Length of the original request to the containers, for legacy clients
+	// sending HTTP/1.0 bodies that would otherwise be proxied chunked. The proxied request is
+	// marked HTTP/1.1 too, but http.Transport always speaks HTTP/1.1 regardless, so only the
+	// Content-Length changes what the containers receive.
+	ForceHTTP11 bool
 }
 
 type Container struct {
@@ -32,44 +254,217 @@ type Container struct {
 	Started bool
 	Dirty   bool
 	IPAddr  string
+	// Secondary container ports keyed by their Docker port spec (e.g. "9001/tcp")
+	ExtraPorts map[string]int
+	// Backend round-trip latencies, updated atomically
+	LatencyHistogram LatencyHistogram
+	// Requests currently being proxied to the container, updated atomically
+	ActiveReqs int64
+	// Requests routed to the container in total, updated atomically
+	RequestCount int64
+	// Names of the named volumes mounted to the container
+	Mounts []string
+	// When the container was last started and became ready
+	StartedAt time.Time
+	// When the container was created in Docker
+	CreatedAt time.Time
+	// Paused containers are frozen in Docker and left out of routing
+	Paused bool
+	// Host ports the container ports are published to, with UseHostPorts
+	HostPorts map[int]int
+	// Times the container has been killed for running out of memory, updated atomically
+	OOMKillCount int64
+	// Bytes received and sent by the container, updated atomically by the health sync
+	NetRxBytes uint64
+	NetTxBytes uint64
+	// Times Docker has restarted the container, updated by the health sync with MaxRestartCount
+	RestartCount int
+
+	consecutiveErrors int64
+	circuitOpenUntil  int64
+	// Filesystem changes already reported by the audit, keyed by path
+	auditedChanges map[string]string
 }
 
 type ReqController struct {
 	DockerCli   docker.Client
+	HttpCli     *http.Client
 	Config      ControllerConfig
-	Containers  []Container
 	ContainerNo int
 	LastReq     time.Time
 	Lock        *sync.RWMutex
+	// Containers mirrors the members of the pool and is only safe to read under Lock.
+	//
+	// Deprecated: use ContainerSnapshots, ContainerByName or ContainerByID instead.
+	Containers []*Container
+
+	networkId      string
+	pauseState     int32
+	pool           *pool.Pool[*Container]
+	requestQueue   chan *pendingRequest
+	stop           chan struct{}
+	background     *sync.WaitGroup
+	ready          chan struct{}
+	readyErr       error
+	lastCreate     time.Time
+	webhook        *webhook.Client
+	exhausted      int32
+	subscribers    *subscribers
+	handler        http.Handler
+	startup        *startupState
+	failover       *failoverState
+	trustedProxies []*net.IPNet
+	pinnedImage    string
+	previousConfig *ControllerConfig
+	dedup          *dedupCache
 }
 
 func DefaultConfig(deployment, image, tag string, port int) ControllerConfig {
 	return ControllerConfig{
-		Deployment:        deployment,
-		ContainerImage:    image,
-		ContainerImageTag: tag,
-		ContainerPort:     port,
-		ContainerAmount:   1,
-		Type:              "dynamic",
-		DynIdleSeconds:    60,
+		Deployment:             deployment,
+		ContainerImage:         image,
+		ContainerImageTag:      tag,
+		ContainerPort:          port,
+		ContainerPorts:         []int{port},
+		ContainerAmount:        1,
+		Type:                   "dynamic",
+		DynIdleSeconds:         60,
+		DockerRetryMaxAttempts: 3,
+		CreateNetworkIfMissing: true,
 	}
 }
 
 func NewReqController(conf ControllerConfig) (ReqController, error) {
 	if !validControllerType(conf.Type) {
-		return ReqController{}, errors.New(fmt.Sprintf("Invalid controller type: %s", conf.Type))
+		return ReqController{}, configError(conf, "Invalid controller type: %s", conf.Type)
+	}
+	if conf.primaryPort() <= 0 {
+		return ReqController{}, configError(conf, "At least one container port must be configured")
+	}
+	if conf.UseContainerAlias && conf.NetworkName == "" {
+		return ReqController{}, configError(conf, "UseContainerAlias requires a deployment network")
+	}
+	if conf.SetContainerHostname && conf.NetworkName == "" {
+		return ReqController{}, configError(conf, "SetContainerHostname requires a deployment network")
+	}
+	if conf.BackendMode != "" && conf.BackendMode != ContainerBackend && conf.BackendMode != SwarmServiceBackend {
+		return ReqController{}, configError(conf, "Invalid backend mode: %s", conf.BackendMode)
+	}
+	if conf.Type == FailoverController && conf.FallbackImage == "" {
+		return ReqController{}, configError(conf, "Failover deployments require FallbackImage")
+	}
+	if conf.swarmMode() && (conf.Type != StaticController || conf.UseContainerAlias || conf.UseHostPorts) {
+		return ReqController{}, configError(conf, "Swarm service backend requires a static controller without container aliases or host ports")
+	}
+	if conf.UseHostPorts && conf.UseContainerAlias {
+		return ReqController{}, configError(conf, "UseHostPorts can't be used together with UseContainerAlias")
+	}
+	if conf.NetworkSubnet != "" || conf.NetworkGateway != "" {
+		if err := validateSubnet(conf); err != nil {
+			return ReqController{}, err
+		}
+	}
+	if err := validateLogDriver(conf); err != nil {
+		return ReqController{}, err
+	}
+	if err := validateTmpfs(conf); err != nil {
+		return ReqController{}, err
+	}
+	if err := validateCORS(conf); err != nil {
+		return ReqController{}, err
+	}
+	if conf.DeduplicateRequestIDHeader != "" && conf.DeduplicateCacheTTLMs <= 0 {
+		return ReqController{}, configError(conf, "DeduplicateRequestIDHeader requires a positive DeduplicateCacheTTLMs")
+	}
+	if conf.MinHealthRatio < 0 || conf.MinHealthRatio > 1 {
+		return ReqController{}, configError(conf, "MinHealthRatio must be between 0 and 1")
+	}
+	if conf.DirtyRevalidationAttempts < 0 {
+		return ReqController{}, configError(conf, "DirtyRevalidationAttempts can't be negative")
+	}
+	if conf.MinContainers < 0 || conf.MinContainers > conf.ContainerAmount {
+		return ReqController{}, configError(conf, "MinContainers must be between 0 and ContainerAmount (%d)", conf.ContainerAmount)
+	}
+	for k := range conf.ExtraLabels {
+		if docker.IsReservedLabel(k) {
+			return ReqController{}, configError(conf, "Extra label %s collides with a label reserved for docker-fpm", k)
+		}
+	}
+	for _, o := range conf.PerContainerOverrides {
+		if o.Index < 0 || o.Index >= conf.ContainerAmount {
+			return ReqController{}, configError(conf, "Container override index %d is outside the pool of %d containers", o.Index, conf.ContainerAmount)
+		}
+		if field := o.fixedField(); field != "" {
+			return ReqController{}, configError(conf, "Container override %d can't change %s, it applies to the whole deployment", o.Index, field)
+		}
+		merged := mergeConfig(conf, o.ControllerConfig)
+		if err := validateLogDriver(merged); err != nil {
+			return ReqController{}, err
+		}
+		if err := validateTmpfs(merged); err != nil {
+			return ReqController{}, err
+		}
+		for k := range o.ExtraLabels {
+			if docker.IsReservedLabel(k) {
+				return ReqController{}, configError(conf, "Extra label %s collides with a label reserved for docker-fpm", k)
+			}
+		}
+	}
+
+	trustedProxies, err := parseTrustedProxies(conf)
+	if err != nil {
+		return ReqController{}, err
+	}
+
+	transport, err := newBackendTransport(conf)
+	if err != nil {
+		return ReqController{}, err
 	}
 
+	lock := &sync.RWMutex{}
 	adm := ReqController{
-		Config:      conf,
-		ContainerNo: 0,
-		Containers:  []Container{},
-		LastReq:     time.Now(),
-		Lock:        &sync.RWMutex{},
+		Config:         conf,
+		ContainerNo:    0,
+		LastReq:        time.Now(),
+		Lock:           lock,
+		pool:           pool.New[*Container](lock, conf.ContainerAmount),
+		background:     &sync.WaitGroup{},
+		subscribers:    newSubscribers(),
+		startup:        newStartupState(),
+		trustedProxies: trustedProxies,
+		dedup:          newDedupCache(conf),
+		HttpCli: &http.Client{
+			Transport: transport,
+		},
+	}
+	if conf.Type == FailoverController {
+		adm.failover = &failoverState{}
+	}
+	if conf.WebhookURL != "" {
+		hook := webhook.NewClient(webhook.Config{
+			URL:         conf.WebhookURL,
+			Secret:      conf.WebhookSecret,
+			MaxAttempts: webhookMaxAttempts,
+			Timeout:     webhookTimeout,
+		})
+		adm.webhook = &hook
+	}
+	if conf.QueueDepth > 0 {
+		adm.requestQueue = make(chan *pendingRequest, conf.QueueDepth)
+	}
+
+	dockerConf := docker.ClientConfig{
+		Logger:               conf.Logger,
+		ReconnectMaxAttempts: conf.DockerReconnectMaxAttempts,
+		ReconnectDelayMs:     conf.DockerReconnectDelayMs,
 	}
-	cli, err := docker.NewClient()
+	if conf.RetryDockerErrors {
+		dockerConf.RetryMaxAttempts = conf.DockerRetryMaxAttempts
+	}
+
+	cli, err := docker.NewClient(dockerConf)
 	if err != nil {
-		return ReqController{}, errors.Wrap(err, "Unable to initialize Docker client")
+		return ReqController{}, err
 	}
 	adm.DockerCli = cli
 
@@ -77,45 +472,185 @@ func NewReqController(conf ControllerConfig) (ReqController, error) {
 }
 
 func (s *ReqController) createNewContainer() error {
+	c, err := s.newContainer(s.pool.Len())
+	if err != nil {
+		return err
+	}
+
+	s.pool.Add(c)
+	s.syncContainers()
+
+	return nil
+}
+
+func (s *ReqController) containerName(n int) (string, error) {
+	if s.Config.ContainerNameFunc == nil {
+		return fmt.Sprintf("%s-%d", s.Config.Deployment, n), nil
+	}
+
+	name := s.Config.ContainerNameFunc(s.Config.Deployment, n)
+	if !validContainerName.MatchString(name) {
+		return "", configError(s.Config, "ContainerNameFunc returned an invalid container name %q", name)
+	}
+
+	return name, nil
+}
+
+// validateLogDriver checks that the log driver is known and its options are complete.
+func validateLogDriver(conf ControllerConfig) error {
+	if conf.LogDriver != "" && !slices.Contains(docker.LogDrivers, conf.LogDriver) {
+		return configError(conf, "Unknown log driver %s, expected one of %s", conf.LogDriver, strings.Join(docker.LogDrivers, ", "))
+	}
+	if len(conf.LogDriverOptions) > 0 && conf.LogDriver == "" {
+		return configError(conf, "LogDriverOptions require LogDriver")
+	}
+	for k, v := range conf.LogDriverOptions {
+		if k == "" || v == "" {
+			return configError(conf, "Log driver options can't be empty (%q: %q)", k, v)
+		}
+	}
+
+	return nil
+}
+
+// newContainer creates a container for the given index in the pool.
+func (s *ReqController) newContainer(index int) (*Container, error) {
+	if s.Config.ContainerCreateDelayMs > 0 {
+		delay := time.Duration(s.Config.ContainerCreateDelayMs) * time.Millisecond
+		if wait := delay - time.Since(s.lastCreate); wait > 0 {
+			time.Sleep(wait)
+		}
+		s.lastCreate = time.Now()
+	}
+
 	s.ContainerNo += 1
+	conf := s.containerConfig(index)
 
-	cName := fmt.Sprintf("%s-%d", s.Config.Deployment, s.ContainerNo)
-	c, err := s.DockerCli.CreateContainer(cName, s.containerImageName(), s.Config.Deployment)
+	cName, err := s.containerName(s.ContainerNo)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	c, err := s.DockerCli.CreateContainer(docker.ContainerOptions{
+		Name:             cName,
+		Image:            s.createImageName(conf),
+		Deployment:       s.Config.Deployment,
+		Ports:            conf.ports(),
+		Labels:           conf.ExtraLabels,
+		Network:          s.Config.NetworkName,
+		Alias:            s.Config.UseContainerAlias || s.Config.SetContainerHostname,
+		Platform:         conf.Platform,
+		PublishPorts:     s.Config.UseHostPorts,
+		AttachStdin:      conf.AttachStdin,
+		Tmpfs:            conf.TmpfsMounts,
+		LogDriver:        conf.LogDriver,
+		LogDriverOptions: conf.LogDriverOptions,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	s.Containers = append(s.Containers, Container{
+	details, err := s.DockerCli.ContainerDetails(c)
+	if err != nil {
+		return nil, &docker.ContainerCreateError{
+			ContainerID:    c,
+			ContainerName:  cName,
+			DeploymentName: s.Config.Deployment,
+			OriginalError:  err,
+		}
+	}
+
+	mounts := []string{}
+	for _, m := range details.Mounts {
+		if m.Type == mount.TypeVolume && m.Name != "" {
+			mounts = append(mounts, m.Name)
+		}
+	}
+
+	return &Container{
 		Name:    cName,
 		Id:      c,
 		Started: false,
 		IPAddr:  "",
-	})
-
-	return nil
+		Mounts:  mounts,
+	}, nil
 }
 
 // This currently starts every configured container. Future work is needed to allow
 // smarter ways for starting & stopping containers based on req/min.
+//
+// Containers are started and probed in parallel. With FailFastOnReadiness, the first failure
+// aborts the probes still waiting, otherwise all of them finish and the failures are returned
+// together.
 func (s *ReqController) startContainers() error {
-	for i, c := range s.Containers {
+	abort := make(chan struct{})
+	abortOnce := &sync.Once{}
+	var wg sync.WaitGroup
+	errs := make([]error, s.pool.Len())
+
+	for i, c := range s.pool.Members() {
 		if c.Started {
 			continue
 		}
 
-		if err := s.DockerCli.StartContainer(c.Id); err != nil {
-			return err
-		}
+		wg.Add(1)
+		go func(i int, c *Container) {
+			defer wg.Done()
+			if errs[i] = s.startContainer(c, abort); errs[i] != nil && s.Config.FailFastOnReadiness {
+				abortOnce.Do(func() { close(abort) })
+			}
+		}(i, c)
+	}
+	wg.Wait()
 
-		details, err := s.DockerCli.ContainerDetails(c.Id)
-		if err != nil {
+	if err := stderrors.Join(errs...); err != nil {
+		return err
+	}
+
+	if s.Config.ValidateConnectivity {
+		return s.validateConnectivity()
+	}
+
+	return nil
+}
+
+// startContainer starts the container and waits until it's ready, unless abort is closed first.
+func (s *ReqController) startContainer(c *Container, abort <-chan struct{}) error {
+	if err := s.DockerCli.StartContainer(c.Id); err != nil {
+		return s.withStartupLogs(c, err)
+	}
+
+	details, err := s.DockerCli.ContainerDetails(c.Id)
+	if err != nil {
+		return err
+	}
+
+	if !s.Config.UseContainerAlias {
+		c.IPAddr = s.containerIP(details)
+	}
+	if created, err := time.Parse(time.RFC3339Nano, details.Created); err == nil {
+		c.CreatedAt = created
+	}
+	if s.Config.UseHostPorts {
+		if err := s.lookupHostPorts(c); err != nil {
 			return err
 		}
+	}
+	c.ExtraPorts = map[string]int{}
+	for _, port := range s.Config.ports()[1:] {
+		spec := nat.Port(fmt.Sprintf("%d/tcp", port))
+		if _, ok := details.Config.ExposedPorts[spec]; ok {
+			c.ExtraPorts[string(spec)] = port
+		}
+	}
 
-		c.IPAddr = details.NetworkSettings.IPAddress
-		c.Started = true
-		s.Containers[i] = c
+	if err := s.waitUntilReady(c, abort); err != nil {
+		return s.withStartupLogs(c, err)
 	}
+	s.warmUp(c)
+
+	c.Started = true
+	c.StartedAt = time.Now()
+	s.notify(webhook.ContainerStarted, c)
 
 	return nil
 }
@@ -123,12 +658,19 @@ func (s *ReqController) startContainers() error {
 // This currently stops every configured container. Future work is needed to allow
 // smarter ways for starting & stopping containers based on req/min.
 func (s *ReqController) stopContainers(hard bool) error {
-	for i, c := range s.Containers {
+	for i, c := range s.pool.Members() {
 		if !c.Started {
 			continue
 		}
 
-		if err := s.DockerCli.StopContainer(c.Id); err != nil {
+		// Requests being proxied would get truncated, so they're given a chance to finish
+		// first. If they don't, there's no point in waiting for a graceful stop either.
+		if !s.drainContainer(c) {
+			s.logger().Warn("container still has active requests after draining, killing it", "deployment", s.Config.Deployment, "name", c.Name, "active", atomic.LoadInt64(&c.ActiveReqs))
+			if err := s.DockerCli.KillContainer(c.Id); err != nil {
+				return err
+			}
+		} else if err := s.DockerCli.StopContainer(c.Id); err != nil {
 			if !hard {
 				return err
 			}
@@ -138,162 +680,854 @@ func (s *ReqController) stopContainers(hard bool) error {
 			}
 		}
 
+		// Stop and kill return before the container has necessarily exited, so we'll wait
+		// to avoid racing with a later removal.
+		ctx, cancel := context.WithTimeout(context.Background(), containerWaitTimeout)
+		_, err := s.DockerCli.WaitForContainer(ctx, c.Id)
+		cancel()
+		if err != nil {
+			return err
+		}
+
 		c.Started = false
 		c.IPAddr = ""
-		s.Containers[i] = c
+		c.ExtraPorts = nil
+		s.pool.Replace(i, c)
+		s.syncContainers()
 	}
 
 	return nil
 }
 
-func (s *ReqController) cleanupContainers() error {
-	for _, c := range s.Containers {
-		if c.Started {
-			if err := s.DockerCli.KillContainer(c.Id); err != nil {
-				return err
+// withStartupLogs adds the container's latest output to a startup error if CaptureStartupLogs
+// is set, so that failures like a bad entrypoint explain themselves.
+func (s *ReqController) withStartupLogs(c *Container, err error) error {
+	if !s.Config.CaptureStartupLogs {
+		return err
+	}
+
+	logs, logErr := s.DockerCli.FetchContainerLogs(context.Background(), c.Id, startupLogLines)
+	if logErr != nil {
+		s.logger().Warn("unable to fetch startup logs", "deployment", s.Config.Deployment, "name", c.Name, "error", logErr)
+		return err
+	}
+
+	return s.containerError(c.Id, err, "Last %d lines of output from container %s:\n%s", startupLogLines, c.Name, logs)
+}
+
+// drainContainer waits up to DrainTimeoutSeconds for the container's in-flight requests to
+// finish and tells if they did. Requests don't need the controller lock to finish, so this
+// is safe to call while holding it.
+func (s *ReqController) drainContainer(c *Container) bool {
+	deadline := time.Now().Add(time.Duration(s.Config.DrainTimeoutSeconds) * time.Second)
+	for atomic.LoadInt64(&c.ActiveReqs) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+
+	return true
+}
+
+// cleanupContainers kills and removes all containers in parallel. Containers that couldn't be
+// removed are returned along with all the errors joined together.
+func (s *ReqController) cleanupContainers() ([]*Container, error) {
+	var wg sync.WaitGroup
+	errs := make([]error, s.pool.Len())
+	for i, c := range s.pool.Members() {
+		wg.Add(1)
+		go func(i int, c *Container) {
+			defer wg.Done()
+			errs[i] = s.removeContainer(c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	failed := []*Container{}
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, s.pool.Members()[i])
+		}
+	}
+
+	return failed, stderrors.Join(errs...)
+}
+
+// acquireContainer selects a container for a request and returns it with its address. The
+// lock is only held for the selection. Active requests are tracked per container instead, so
+// that stopping containers can wait for them to finish. Callers must call the returned
+// release function once the request is done.
+func (s *ReqController) acquireContainer(r *http.Request) (*Container, string, func(), error) {
+	selectStart := time.Now()
+	strategy := s.Config.selectionStrategy()
+	// The address is read under the lock too, as it changes when containers are reconnected.
+	var addr string
+	chosen, release, err := s.pool.GetWith(func(members []*Container) (*Container, error) {
+		chosen, err := strategy.Select(members, r)
+		if err != nil {
+			return nil, err
+		}
+		if affinity, ok := strategy.(affinityStrategy); ok && s.logger().Enabled(r.Context(), slog.LevelDebug) {
+			if home := affinity.preferred(members, r); home != nil && home != chosen {
+				s.logger().Debug("container is not available, routing session to another one", "deployment", s.Config.Deployment, "name", home.Name, "fallback", chosen.Name)
 			}
 		}
+		addr = s.backendAddr(chosen, s.Config.primaryPort())
+		return chosen, nil
+	})
+	selectionLatency.WithLabelValues(s.Config.Deployment, strategyName(strategy)).Observe(time.Since(selectStart).Seconds())
+	s.notifyExhausted(err != nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return chosen, addr, release, nil
+}
+
+// setContainerDirty notifies the cleanup routine about a broken container without blocking
+// or locking. If the queue is full, the notification is dropped: the cleanup routine already
+// has work queued and the next failing request will report the container again.
+func (s *ReqController) setContainerDirty(id string) {
+	if s.Config.swarmMode() {
+		return
+	}
+
+	if !s.pool.MarkDirty(id) {
+		s.logger().Warn("dirty container queue is full, dropping notification", "deployment", s.Config.Deployment, "id", docker.ShortID(id))
+	}
+}
+
+// syncContainers updates the deprecated Containers field after the pool has changed.
+func (s *ReqController) syncContainers() {
+	s.Containers = s.pool.Members()
+}
+
+// logger returns the configured logger, or the default one.
+func (s *ReqController) logger() *slog.Logger {
+	if s.Config.Logger != nil {
+		return s.Config.Logger
+	}
+
+	return slog.Default()
+}
+
+// backendHost returns the host requests to the container are sent to.
+func (s *ReqController) backendHost(c *Container) string {
+	if s.Config.UseContainerAlias {
+		return c.Name
+	}
+	if s.Config.UseHostPorts || (s.Config.swarmMode() && c.IPAddr == "") {
+		return "127.0.0.1"
+	}
+
+	return c.IPAddr
+}
+
+// backendAddr returns the address the container's port is reached at.
+func (s *ReqController) backendAddr(c *Container, port int) string {
+	if hostPort, ok := c.HostPorts[port]; ok {
+		port = hostPort
+	}
+
+	return net.JoinHostPort(s.backendHost(c), strconv.Itoa(port))
+}
 
-		if err := s.DockerCli.RemoveContainer(c.Id); err != nil {
+// lookupHostPorts finds the host ports the container's primary and probe ports are published to.
+func (s *ReqController) lookupHostPorts(c *Container) error {
+	c.HostPorts = map[int]int{}
+	for _, port := range []int{s.Config.primaryPort(), s.Config.probePort()} {
+		hostPort, err := s.DockerCli.GetContainerPort(context.Background(), c.Id, port)
+		if err != nil {
 			return err
 		}
+		c.HostPorts[port] = hostPort
 	}
 
 	return nil
 }
 
-func (s *ReqController) getRandomContainer() (Container, error) {
-	amount := len(s.Containers)
-	if amount == 0 {
-		return Container{}, errors.New("No configured containers to choose from")
+// containerIP returns the container's address in the deployment network, or in the
+// default bridge network when no deployment network is used.
+func (s *ReqController) containerIP(details types.ContainerJSON) string {
+	if details.NetworkSettings == nil {
+		return ""
 	}
 
-	// TODO revisit this when some containers can be up or down at the same time in dynamic mode
-	for attempts := 1; attempts <= s.Config.ContainerAmount; attempts++ {
-		random := rand.Intn(amount)
-		candidate := s.Containers[random]
-		if !candidate.Dirty && candidate.Started {
-			return candidate, nil
+	if s.Config.NetworkName != "" {
+		if endpoint, ok := details.NetworkSettings.Networks[s.Config.NetworkName]; ok {
+			return endpoint.IPAddress
 		}
+		return ""
 	}
 
-	// If quick selection didn't work out, we'll get the first available that matches
-	for _, candidate := range s.Containers {
-		if !candidate.Dirty && candidate.Started {
-			return candidate, nil
+	return details.NetworkSettings.IPAddress
+}
+
+// checkImage warns when the image doesn't expose the primary port. It's not an error, as many
+// PHP-FPM images bind their port without an EXPOSE in the Dockerfile.
+func (s *ReqController) checkImage() error {
+	info, err := s.DockerCli.InspectImage(context.Background(), s.Config.ContainerImage, s.Config.ContainerImageTag)
+	if err != nil {
+		return err
+	}
+
+	port := s.Config.primaryPort()
+	for _, exposed := range info.ExposedPorts {
+		if exposed == port {
+			return nil
 		}
 	}
 
-	return Container{}, errors.New("All containers are either shut down or marked as dirty")
+	s.logger().Warn("image does not expose the container port", "deployment", s.Config.Deployment, "image", s.containerImageName(), "port", port)
+	return nil
 }
 
-func (s *ReqController) setContainerDirty(id string) {
-	for i, c := range s.Containers {
-		if c.Id == id {
-			c.Dirty = true
-			s.Containers[i] = c
-		}
+// pullImage pulls the deployment image. If the registry can't be reached, a locally cached
+// copy of the image is used instead.
+func (s *ReqController) pullImage() error {
+	pullErr := s.DockerCli.PullImageWithRetry(context.Background(), s.Config.ContainerImage, s.Config.ContainerImageTag, s.Config.Platform, s.Config.RegistryAuth, ioutil.Discard, s.Config.PullMaxAttempts, time.Duration(s.Config.PullBackoffMs)*time.Millisecond)
+	if pullErr == nil {
+		return nil
 	}
+
+	cached, err := s.DockerCli.ImageExists(context.Background(), s.Config.ContainerImage, s.Config.ContainerImageTag)
+	if err != nil || !cached {
+		return pullErr
+	}
+
+	s.logger().Warn("unable to pull image, using the local copy", "deployment", s.Config.Deployment, "image", s.containerImageName(), "error", pullErr)
+	return nil
+}
+
+// ListImages lists the locally available versions of the deployment image.
+func (s *ReqController) ListImages() ([]docker.ImageSummary, error) {
+	return s.DockerCli.ListImages(context.Background(), s.Config.ContainerImage)
 }
 
 func (s *ReqController) containerImageName() string {
-	return fmt.Sprintf("%s:%s", s.Config.ContainerImage, s.Config.ContainerImageTag)
+	return s.Config.imageName()
 }
 
+// createImageName returns the image containers are created from, preferring the pinned image
+// and the local cache tag for containers using the deployment's own image.
+func (s *ReqController) createImageName(conf ControllerConfig) string {
+	if conf.imageName() != s.Config.imageName() {
+		return conf.imageName()
+	}
+	if s.pinnedImage != "" {
+		return s.pinnedImage
+	}
+	if s.Config.LocalCacheTag != "" {
+		return s.Config.LocalCacheTag
+	}
+
+	return conf.imageName()
+}
+
+// pinImage tags the pulled image as docker-fpm/<deployment>:<image ID>, so that all containers
+// of the controller run the same image even if the upstream tag is moved mid-deployment.
+func (s *ReqController) pinImage() error {
+	info, err := s.DockerCli.InspectImage(context.Background(), s.Config.ContainerImage, s.Config.ContainerImageTag)
+	if err != nil {
+		return err
+	}
+
+	pinned := fmt.Sprintf("docker-fpm/%s:%s", strings.ToLower(s.Config.Deployment), strings.TrimPrefix(info.ID, "sha256:"))
+	if err := s.DockerCli.TagImage(context.Background(), info.ID, pinned); err != nil {
+		return err
+	}
+	s.pinnedImage = pinned
+
+	return nil
+}
+
+// Init creates the deployment's containers, starting them in static mode. If a previous
+// Init failed halfway, calling it again completes the initialization using Reconcile.
 func (s *ReqController) Init() error {
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
 
+	if s.pool.Len() > 0 {
+		if err := s.reconcile(); err != nil {
+			return err
+		}
+		s.startBackground()
+		return nil
+	}
+
+	return s.initialize(s.Config.ContainerAmount)
+}
+
+// setupNetwork makes sure the deployment network exists, creating it with
+// CreateNetworkIfMissing.
+func (s *ReqController) setupNetwork() error {
+	exists, err := s.DockerCli.NetworkExists(context.Background(), s.Config.NetworkName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if !s.Config.CreateNetworkIfMissing {
+		return configError(s.Config, "Network %s doesn't exist. Create it or set CreateNetworkIfMissing to have it created like before.", s.Config.NetworkName)
+	}
+
+	if s.Config.NetworkSubnet != "" {
+		if err := s.checkSubnetOverlap(); err != nil {
+			return err
+		}
+	}
+
+	id, err := s.DockerCli.CreateNetwork(context.Background(), s.Config.NetworkName, s.Config.Deployment, !s.Config.NetworkAllowExternal, s.Config.NetworkSubnet, s.Config.NetworkGateway)
+	if err != nil {
+		return err
+	}
+	s.networkId = id
+
+	return nil
+}
+
+// initialize prepares the image and network and brings the deployment up to amount containers.
+func (s *ReqController) initialize(amount int) error {
 	// Yeah yeah, but we're selecting random containers and not doing cryptography. Come at me, cyberbros.
 	rand.Seed(time.Now().UnixNano())
 
-	for i := 0; i < s.Config.ContainerAmount; i++ {
-		if err := s.createNewContainer(); err != nil {
+	if s.Config.AutoPull {
+		if err := s.pullImage(); err != nil {
 			return err
 		}
 	}
 
-	if s.Config.Type == StaticController {
-		if err := s.startContainers(); err != nil {
+	if err := s.checkImage(); err != nil {
+		return err
+	}
+
+	if s.Config.LocalCacheTag != "" {
+		if err := s.DockerCli.TagImage(context.Background(), s.containerImageName(), s.Config.LocalCacheTag); err != nil {
 			return err
 		}
 	}
 
-	// TODO have that container-restarting cleanup routine to handle dirty containers
+	if s.Config.AutoPull {
+		if err := s.pinImage(); err != nil {
+			return err
+		}
+	}
+
+	if s.Config.swarmMode() {
+		if err := s.initService(); err != nil {
+			return err
+		}
+		s.startBackground()
+		return nil
+	}
+
+	if s.Config.NetworkName != "" && s.networkId == "" {
+		if err := s.setupNetwork(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.reconcileTo(amount); err != nil {
+		return err
+	}
+
+	s.startBackground()
+
 	// TODO have the same cleanup routine stop dynamic containers that have been running too long
 
 	return nil
 }
 
+// startBackground starts the background routines, unless they're already running.
+func (s *ReqController) startBackground() {
+	if s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.background.Add(1)
+	go s.cleanupDirty()
+
+	if s.requestQueue != nil {
+		for i := 0; i < s.Config.ContainerAmount; i++ {
+			s.background.Add(1)
+			go s.queueWorker()
+		}
+	}
+
+	if !s.Config.swarmMode() {
+		s.background.Add(1)
+		go s.watchEvents()
+	}
+	if !s.Config.swarmMode() && !s.Config.UseContainerAlias && !s.Config.UseHostPorts {
+		s.background.Add(1)
+		go s.watchNetwork()
+	}
+
+	if s.Config.HealthSyncIntervalSeconds > 0 {
+		s.background.Add(1)
+		go s.healthSync(time.Duration(s.Config.HealthSyncIntervalSeconds) * time.Second)
+	}
+}
+
 func (s *ReqController) Close() error {
+	// Background routines need the lock, so they have to be stopped before we grab it.
+	if s.stop != nil {
+		close(s.stop)
+		s.background.Wait()
+		s.stop = nil
+	}
+
+	// The fallback pool shares the deployment network, so it has to go first.
+	if err := s.closeFallback(); err != nil {
+		return err
+	}
+
 	s.Lock.Lock()
 	defer s.Lock.Unlock()
 
-	if err := s.cleanupContainers(); err != nil {
-		return errors.Wrap(err, "Unable to cleanup containers")
+	if s.Config.swarmMode() {
+		if err := s.removeService(); err != nil {
+			return s.deploymentError(err, "Unable to remove service")
+		}
+		s.pool.Set([]*Container{})
+		s.syncContainers()
+		return nil
+	}
+
+	// Everything is cleaned up as far as possible, and the failures reported together. Containers
+	// that couldn't be removed are kept, so that calling Close again retries them.
+	errs := []error{}
+	failed, err := s.cleanupContainers()
+	if err != nil {
+		errs = append(errs, s.deploymentError(err, "Unable to cleanup containers"))
+	}
+	removed := s.pool.Members()
+	s.pool.Set(failed)
+	s.syncContainers()
+
+	if s.Config.RemoveVolumes {
+		for _, c := range removed {
+			if slices.Contains(failed, c) {
+				continue
+			}
+			for _, vol := range c.Mounts {
+				if err := s.DockerCli.RemoveVolume(vol); err != nil && !docker.IsNotFound(err) {
+					errs = append(errs, s.containerError(c.Id, err, "Unable to cleanup container volumes"))
+				}
+			}
+		}
+	}
+
+	if s.networkId != "" {
+		if err := s.DockerCli.RemoveNetwork(context.Background(), s.networkId); err != nil {
+			errs = append(errs, s.deploymentError(err, "Unable to cleanup deployment network"))
+		} else {
+			s.networkId = ""
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// Prune removes leftover stopped containers of the deployment, e.g. ones left behind
+// by a failed initialization, that are older than olderThan.
+func (s *ReqController) Prune(olderThan time.Duration) error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	// Containers of a dynamic deployment stay in created state until needed, so our own must be kept.
+	own := []string{}
+	for _, c := range s.pool.Members() {
+		own = append(own, c.Id)
+	}
+
+	removed, err := s.DockerCli.PruneDeploymentContainers(context.Background(), s.Config.Deployment, olderThan, own...)
+	if len(removed) > 0 {
+		s.logger().Info("pruned stopped containers", "deployment", s.Config.Deployment, "removed", len(removed))
+	}
+	if err != nil {
+		return s.deploymentError(err, "Unable to prune containers")
 	}
 
 	return nil
 }
 
-func (s *ReqController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("Request from %s: ", r.RemoteAddr)          // DEBUG
-	fmt.Printf("%#v\n%#v\n%#v\n", r.URL, r.Host, r.Header) // DEBUG
+// UpdateResources changes the CPU and memory limits of all started containers without
+// recreating them. Containers created afterwards don't inherit the new limits.
+func (s *ReqController) UpdateResources(resources container.Resources) error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
 
-	// In dynamic mode container(s) can be shut down, so we're starting them if that is the case.
-	if s.Config.Type == DynamicController && !s.Containers[0].Started {
-		s.Lock.Lock()
-		if err := s.startContainers(); err != nil {
-			// TODO log error
-			s.Lock.Unlock()
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+	for _, c := range s.pool.Members() {
+		if !c.Started {
+			continue
+		}
+		if err := s.DockerCli.UpdateContainer(context.Background(), c.Id, resources); err != nil {
+			return s.deploymentError(err, "Unable to update resources of deployment %s", s.Config.Deployment)
 		}
-		s.Lock.Unlock()
+	}
+
+	return nil
+}
+
+// InjectFile writes content to path in all started containers at the same time, e.g. for
+// changing a configuration file without rebuilding the image. The containing directory must
+// exist. Containers created afterwards won't have the file.
+func (s *ReqController) InjectFile(path string, content io.Reader) error {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return s.deploymentError(err, "Unable to read file content")
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    filepath.Base(path),
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return s.deploymentError(err, "Unable to create file archive")
+	}
+	if _, err := tw.Write(data); err != nil {
+		return s.deploymentError(err, "Unable to create file archive")
+	}
+	if err := tw.Close(); err != nil {
+		return s.deploymentError(err, "Unable to create file archive")
 	}
 
 	s.Lock.RLock()
 	defer s.Lock.RUnlock()
 
-	chosen, err := s.getRandomContainer()
+	var wg sync.WaitGroup
+	errs := make(chan error, s.pool.Len())
+	for _, c := range s.pool.Members() {
+		if !c.Started {
+			continue
+		}
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			errs <- s.DockerCli.CopyToContainer(context.Background(), id, filepath.Dir(path), bytes.NewReader(archive.Bytes()))
+		}(c.Id)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return s.deploymentError(err, "Unable to inject %s to deployment %s", path, s.Config.Deployment)
+		}
+	}
+
+	return nil
+}
+
+// AuditImage returns the layer history of the deployment's image for verifying its contents
+// before deployment. It's not used by the controller itself.
+func (s *ReqController) AuditImage() ([]docker.ImageLayer, error) {
+	layers, err := s.DockerCli.ImageHistory(context.Background(), s.Config.ContainerImage, s.Config.ContainerImageTag)
 	if err != nil {
-		// TODO log error
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, s.deploymentError(err, "Unable to audit image %s", s.containerImageName())
 	}
 
-	url := r.URL
-	url.Host = fmt.Sprintf("%s:%d", chosen.IPAddr, s.Config.ContainerPort)
+	return layers, nil
+}
 
-	proxyReq, err := http.NewRequest(r.Method, url.String(), r.Body)
+// AuditContainerFilesystem returns the filesystem changes made in the container since it
+// was created from the image.
+func (s *ReqController) AuditContainerFilesystem(id string) ([]docker.ContainerChange, error) {
+	changes, err := s.DockerCli.ContainerDiff(context.Background(), id)
 	if err != nil {
-		// TODO log error
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, s.containerError(id, err, "Unable to audit filesystem of container %s", docker.ShortID(id))
 	}
 
-	proxyReq.Header = r.Header
+	return changes, nil
+}
+
+// RoundTrip proxies the request to one of the deployment's containers, so that the
+// controller can be used as the Transport of an http.Client. Failures are returned as
+// *ProxyError. The container counts as busy until the response body is closed.
+func (s *ReqController) RoundTrip(r *http.Request) (*http.Response, error) {
+	if s.IsPaused() {
+		return nil, s.proxyError(http.StatusServiceUnavailable, errors.New("Deployment is paused"))
+	}
+
+	if !s.methodAllowed(r.Method) {
+		return nil, s.proxyError(http.StatusMethodNotAllowed, errors.New(fmt.Sprintf("Method %s is not allowed", r.Method)))
+	}
+
+	if s.Config.MinHealthRatio > 0 && s.containersStarted() {
+		if ratio := s.HealthRatio(); ratio < s.Config.MinHealthRatio {
+			return nil, s.proxyError(http.StatusServiceUnavailable, errors.New(fmt.Sprintf("Only %.0f%% of containers are healthy", ratio*100)))
+		}
+	}
+
+	// In dynamic mode container(s) can be shut down, so we're starting them if that is the case.
+	if s.Config.Type == DynamicController && !s.containersStarted() {
+		if err := s.ensureStarted(); err != nil {
+			return nil, s.proxyError(http.StatusInternalServerError, err)
+		}
+	}
+
+	ctx := r.Context()
+	chosen, addr, release, err := s.acquireContainer(r)
+	if err != nil && s.requestQueue != nil {
+		res, queued := s.enqueue(ctx, r)
+		if !queued {
+			err = errors.New("Request queue is full")
+		} else {
+			chosen, addr, release, err = res.container, res.addr, res.release, res.err
+		}
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, s.proxyError(http.StatusGatewayTimeout, err)
+		}
+		if s.failover != nil {
+			return s.roundTripFallback(r)
+		}
+		return nil, s.proxyError(http.StatusServiceUnavailable, err)
+	}
+
+	url := *r.URL
+	url.Scheme = "http"
+	if s.Config.BackendTLSConfig != nil {
+		url.Scheme = "https"
+	}
+	url.Host = addr
+
+	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, url.String(), r.Body)
+	if err != nil {
+		release()
+		return nil, s.proxyError(http.StatusInternalServerError, err)
+	}
+
+	proxyReq.Header = r.Header.Clone()
+	for _, h := range s.Config.StripRequestHeaders {
+		proxyReq.Header.Del(h)
+	}
+	s.injectParams(r, proxyReq)
+	if s.Config.ForceHTTP11 {
+		proxyReq.Proto = "HTTP/1.1"
+		proxyReq.ProtoMajor = 1
+		proxyReq.ProtoMinor = 1
+		// Otherwise the body would be sent chunked, which PHP may not read.
+		proxyReq.ContentLength = r.ContentLength
+	}
+
+	proxyReq.Host = r.Host
+	if s.Config.OverrideHost != "" {
+		proxyReq.Host = s.Config.OverrideHost
+		proxyReq.Header.Set("X-Original-Host", r.Host)
+	}
 
 	// If we'll allow non-FCGI connections, it might be good to set this (or trust it if r.RemoteAddr is a known one)
 	// proxyReq.Header.Set("X-Forwarded-For", r.RemoteAddr)
 
-	client := &http.Client{}
-	res, err := client.Do(proxyReq)
+	reqStart := time.Now()
+	res, err := s.HttpCli.Do(proxyReq)
+	if err != nil {
+		release()
+		// Running out of time is not the container's fault, so it's not held against it.
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, s.proxyError(http.StatusGatewayTimeout, err)
+		}
+		return nil, s.proxyError(s.classifyProxyError(chosen, err), err)
+	}
+	s.recordProxySuccess(chosen)
+	s.observeLatency(chosen, time.Since(reqStart))
+
+	res.Body = &releasingBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// releasingBody releases the container it was proxied from once closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
+
+// Use wraps request handling with the middleware, the first one being the outermost. Calling
+// it again wraps the existing chain. It's not safe to call while serving requests.
+func (s *ReqController) Use(mw ...middleware.Middleware) {
+	h := s.handler
+	if h == nil {
+		h = http.HandlerFunc(s.route)
+	}
+
+	s.handler = middleware.Chain(h, mw...)
+}
+
+func (s *ReqController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.handler != nil {
+		s.handler.ServeHTTP(w, r)
+		return
+	}
+
+	s.route(w, r)
+}
+
+// proxy responds to the request with the response of a container.
+func (s *ReqController) proxy(w http.ResponseWriter, r *http.Request) {
+	if s.Config.StripURIPrefix != "" {
+		stripped, ok := stripPrefix(r, s.Config.StripURIPrefix)
+		if !ok {
+			s.writeError(w, r, http.StatusNotFound)
+			return
+		}
+		r = stripped
+	}
+	if len(s.trustedProxies) > 0 {
+		r = s.withRealIP(r)
+	}
+
+	ctx := r.Context()
+	if s.Config.RequestTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.Config.RequestTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	res, err := s.RoundTrip(r.WithContext(ctx))
 	if err != nil {
+		status := http.StatusBadGateway
+		var proxyErr *ProxyError
+		if errors.As(err, &proxyErr) {
+			status = proxyErr.StatusCode
+		}
+		if status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", strings.Join(s.Config.AllowedMethods, ", "))
+		}
+		if status == http.StatusGatewayTimeout {
+			s.timedOut(ctx, r)
+		}
 		// TODO log error
-		// TODO should we unlock RLock and get an actual lock before doing this?
-		s.setContainerDirty(chosen.Id)
-		w.WriteHeader(http.StatusBadGateway)
+		s.writeError(w, r, status)
 		return
 	}
 	defer res.Body.Close()
 
 	copyHeader(w.Header(), res.Header)
+	s.injectResponseHeaders(w.Header())
+	if s.Config.CORSConfig != nil {
+		s.injectCORSHeaders(w.Header(), r)
+	}
 	w.WriteHeader(res.StatusCode)
-	io.Copy(w, res.Body)
+	if _, err := io.Copy(w, res.Body); err != nil {
+		// Headers are already sent, so all we can do is stop copying.
+		s.timedOut(ctx, r)
+	}
+}
 
-	//w.Write([]byte("This is a FastCGI example server.\n")) // TODO actually do something
-	//w.WriteHeader(200)
+// writeError answers with an empty error response. The CORS headers are added as for
+// proxied responses, so that browsers let the application see the error.
+func (s *ReqController) writeError(w http.ResponseWriter, r *http.Request, status int) {
+	if s.Config.CORSConfig != nil {
+		s.injectCORSHeaders(w.Header(), r)
+	}
+	w.WriteHeader(status)
+}
+
+// stripPrefix returns a copy of the request with prefix removed from its path. False is
+// returned if the path doesn't start with prefix.
+func stripPrefix(r *http.Request, prefix string) (*http.Request, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	path := r.URL.Path
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return nil, false
+	}
+
+	stripped := r.Clone(r.Context())
+	stripped.URL.Path = strings.TrimPrefix(path, prefix)
+	if stripped.URL.Path == "" {
+		stripped.URL.Path = "/"
+	}
+	if r.URL.RawPath != "" {
+		stripped.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, prefix)
+		if stripped.URL.RawPath == "" {
+			stripped.URL.RawPath = "/"
+		}
+	}
+
+	return stripped, true
+}
+
+func (c ControllerConfig) imageName() string {
+	return fmt.Sprintf("%s:%s", c.ContainerImage, c.ContainerImageTag)
+}
+
+// ports returns the configured container ports, falling back to the deprecated
+// ContainerPort when ContainerPorts is not set.
+func (c ControllerConfig) ports() []int {
+	if len(c.ContainerPorts) > 0 {
+		return c.ContainerPorts
+	}
+	if c.ContainerPort > 0 {
+		return []int{c.ContainerPort}
+	}
+
+	return []int{}
+}
+
+func (c ControllerConfig) primaryPort() int {
+	ports := c.ports()
+	if len(ports) == 0 {
+		return 0
+	}
+
+	return ports[0]
+}
+
+func (c ControllerConfig) probePort() int {
+	if c.ReadinessProbePort > 0 {
+		return c.ReadinessProbePort
+	}
+
+	return c.primaryPort()
+}
+
+// timedOut tells if the request ran out of its RequestTimeoutSeconds, logging it if so.
+func (s *ReqController) timedOut(ctx context.Context, r *http.Request) bool {
+	if ctx.Err() != context.DeadlineExceeded {
+		return false
+	}
+
+	s.logger().Warn("request timed out", "deployment", s.Config.Deployment, "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "timeout_seconds", s.Config.RequestTimeoutSeconds)
+	return true
+}
+
+func (s *ReqController) methodAllowed(method string) bool {
+	if len(s.Config.AllowedMethods) == 0 {
+		return true
+	}
+
+	for _, allowed := range s.Config.AllowedMethods {
+		if strings.EqualFold(method, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *ReqController) injectResponseHeaders(h http.Header) {
+	for k, v := range s.Config.InjectResponseHeaders {
+		if h.Get(k) != "" && !s.Config.OverrideExistingHeaders {
+			continue
+		}
+
+		h.Set(k, v)
+	}
 }
 
 func copyHeader(dst, src http.Header) {
@@ -304,6 +1538,11 @@ func copyHeader(dst, src http.Header) {
 	}
 }
 
+// startsImmediately tells if the containers are started on creation instead of on demand.
+func (c ControllerConfig) startsImmediately() bool {
+	return c.Type == StaticController || c.Type == FailoverController
+}
+
 func validControllerType(c string) bool {
 	for _, valid := range controllerTypes {
 		if c == valid {
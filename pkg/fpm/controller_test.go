@@ -0,0 +1,148 @@
+package fpm
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestController returns a static controller routing to the backend, without Docker.
+func newTestController(t *testing.T, backend *httptest.Server, configure func(conf *ControllerConfig)) *ReqController {
+	t.Helper()
+
+	conf := DefaultConfig("test", "php", "fpm", backendPort(t, backend))
+	conf.Type = StaticController
+	if configure != nil {
+		configure(&conf)
+	}
+
+	s, err := NewReqController(conf)
+	if err != nil {
+		t.Fatalf("unable to create controller: %s", err)
+	}
+
+	s.Lock.Lock()
+	s.pool.Add(&Container{Name: "test", Id: "test", Started: true, IPAddr: "127.0.0.1"})
+	s.syncContainers()
+	s.Lock.Unlock()
+
+	return &s
+}
+
+func backendPort(t *testing.T, backend *httptest.Server) int {
+	t.Helper()
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(backend.URL, "http://"))
+	if err != nil {
+		t.Fatalf("invalid backend address %s: %s", backend.URL, err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	return p
+}
+
+// http10Request reads a raw HTTP/1.0 request with a body, as a legacy client would send it.
+func http10Request(t *testing.T, body string) *http.Request {
+	t.Helper()
+
+	raw := "POST /index.php HTTP/1.0\r\nHost: example.com\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("unable to read request: %s", err)
+	}
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	return r
+}
+
+func TestForceHTTP11(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		var proto string
+		var contentLength int64
+		var received string
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proto = r.Proto
+			contentLength = r.ContentLength
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		}))
+
+		s := newTestController(t, backend, func(conf *ControllerConfig) {
+			conf.ForceHTTP11 = force
+		})
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, http10Request(t, "hello"))
+		backend.Close()
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("ForceHTTP11=%t: expected status 200, got %d", force, w.Code)
+		}
+		if proto != "HTTP/1.1" {
+			t.Errorf("ForceHTTP11=%t: backend received %s, expected HTTP/1.1", force, proto)
+		}
+		if received != "hello" {
+			t.Errorf("ForceHTTP11=%t: backend received body %q", force, received)
+		}
+		if force && contentLength != 5 {
+			t.Errorf("ForceHTTP11=true: backend received Content-Length %d, expected 5", contentLength)
+		}
+		if !force && contentLength != -1 {
+			t.Errorf("ForceHTTP11=false: expected the body to be sent chunked, got Content-Length %d", contentLength)
+		}
+	}
+}
+
+func TestCORSHeadersOnErrors(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	s := newTestController(t, backend, func(conf *ControllerConfig) {
+		conf.AllowedMethods = []string{http.MethodGet}
+		conf.CORSConfig = &CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}
+	})
+
+	r := httptest.NewRequest(http.MethodDelete, "/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://app.example.com" {
+		t.Errorf("expected the allowed origin on the error response, got %q", origin)
+	}
+}
+
+func TestCORSPreflightPassesMiddleware(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	s := newTestController(t, backend, func(conf *ControllerConfig) {
+		conf.CORSConfig = &CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}
+	})
+	seen := 0
+	s.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen++
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected the preflight to be answered with 204, got %d", w.Code)
+	}
+	if seen != 1 {
+		t.Errorf("expected the preflight to pass the middleware, it was seen %d times", seen)
+	}
+}
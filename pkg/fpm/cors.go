@@ -0,0 +1,82 @@
+package fpm
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig answers CORS preflight requests in the controller and adds the CORS headers to
+// proxied and error responses, so the applications don't have to handle CORS themselves.
+type CORSConfig struct {
+	// Origins allowed to make cross-origin requests, "*" allows any
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// How long browsers may cache the preflight response, zero leaves it to the browser
+	MaxAgeSeconds int
+}
+
+func validateCORS(conf ControllerConfig) error {
+	if conf.CORSConfig == nil {
+		return nil
+	}
+	if len(conf.CORSConfig.AllowedOrigins) == 0 {
+		return configError(conf, "CORSConfig requires at least one allowed origin")
+	}
+	for _, origin := range conf.CORSConfig.AllowedOrigins {
+		if origin == "" {
+			return configError(conf, "CORS allowed origins can't be empty")
+		}
+	}
+	if conf.CORSConfig.MaxAgeSeconds < 0 {
+		return configError(conf, "CORS MaxAgeSeconds can't be negative")
+	}
+
+	return nil
+}
+
+// allowedOrigin returns the value for Access-Control-Allow-Origin, or an empty string if
+// the origin of the request isn't allowed.
+func (c *CORSConfig) allowedOrigin(origin string) string {
+	if slices.Contains(c.AllowedOrigins, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(c.AllowedOrigins, origin) {
+		return origin
+	}
+
+	return ""
+}
+
+// injectCORSHeaders sets the CORS headers of an allowed origin to the response, replacing
+// any the container might have set.
+func (s *ReqController) injectCORSHeaders(h http.Header, r *http.Request) {
+	cors := s.Config.CORSConfig
+	allowed := cors.allowedOrigin(r.Header.Get("Origin"))
+	if allowed != "*" {
+		// The response depends on the origin, so caches have to keep them apart.
+		h.Add("Vary", "Origin")
+	}
+	if allowed == "" {
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", allowed)
+	if len(cors.AllowedMethods) > 0 {
+		h.Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+	}
+	if len(cors.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+	}
+}
+
+// preflight answers an OPTIONS request without routing it to a container.
+func (s *ReqController) preflight(w http.ResponseWriter, r *http.Request) {
+	s.injectCORSHeaders(w.Header(), r)
+	if s.Config.CORSConfig.MaxAgeSeconds > 0 && w.Header().Get("Access-Control-Allow-Origin") != "" {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(s.Config.CORSConfig.MaxAgeSeconds))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,87 @@
+package fpm
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FetchCrashDump copies CrashDumpPath from the container to a new directory in destDir,
+// named after the container and the time of fetching.
+func (s *ReqController) FetchCrashDump(containerID, destDir string) error {
+	if s.Config.CrashDumpPath == "" {
+		return configError(s.Config, "CrashDumpPath is not set")
+	}
+
+	content, err := s.DockerCli.CopyFromContainer(context.Background(), containerID, s.Config.CrashDumpPath)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	dir := filepath.Join(destDir, fmt.Sprintf("%s-%s-%d", s.Config.Deployment, docker.ShortID(containerID), time.Now().Unix()))
+	if err := extractTar(content, dir); err != nil {
+		return s.containerError(containerID, err, "Unable to store crash dump of container %s", docker.ShortID(containerID))
+	}
+
+	return nil
+}
+
+// extractTar writes the regular files and directories of the archive under dir. Entries
+// pointing outside of dir are rejected.
+func extractTar(archive io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, hdr.Name)
+		if target != dir && !strings.HasPrefix(target, dir+string(os.PathSeparator)) {
+			return errors.New(fmt.Sprintf("Archive entry %s is outside of the destination", hdr.Name))
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0750); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeFile(path string, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
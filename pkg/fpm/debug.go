@@ -0,0 +1,102 @@
+package fpm
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+const redacted = "[REDACTED]"
+
+// DumpState returns a JSON-serializable snapshot of the controller for debugging, e.g. for
+// support bundles. Credentials in the configuration are redacted. If the controller lock is
+// held for writing, containers and stats are left out instead of waiting for it.
+func (s *ReqController) DumpState() map[string]interface{} {
+	state := map[string]interface{}{
+		"deployment": s.Config.Deployment,
+		"paused":     s.IsPaused(),
+		"config":     redactedConfig(s.Config),
+		"lock":       s.lockState(),
+	}
+
+	if !s.Lock.TryRLock() {
+		return state
+	}
+	containers := []map[string]interface{}{}
+	for _, c := range s.pool.Members() {
+		containers = append(containers, map[string]interface{}{
+			"name":         c.Name,
+			"id":           c.Id,
+			"started":      c.Started,
+			"dirty":        c.Dirty,
+			"paused":       c.Paused,
+			"ip":           c.IPAddr,
+			"activeReqs":   atomic.LoadInt64(&c.ActiveReqs),
+			"requestCount": atomic.LoadInt64(&c.RequestCount),
+			"circuitOpen":  c.CircuitOpen(),
+		})
+	}
+	s.Lock.RUnlock()
+
+	state["containers"] = containers
+	state["stats"] = s.Stats()
+
+	return state
+}
+
+// lockState tells whether the controller lock is currently free, read-locked or write-locked.
+func (s *ReqController) lockState() string {
+	if s.Lock.TryLock() {
+		s.Lock.Unlock()
+		return "free"
+	}
+	if s.Lock.TryRLock() {
+		s.Lock.RUnlock()
+		return "read-locked"
+	}
+
+	return "write-locked"
+}
+
+// redactedConfig returns the configuration as a map, with credentials redacted and values
+// that can't be serialized (functions, loggers, TLS configs) only marked as set.
+func redactedConfig(conf ControllerConfig) map[string]interface{} {
+	out := map[string]interface{}{}
+	v := reflect.ValueOf(conf)
+
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		field := v.Field(i)
+
+		switch {
+		case name == "RegistryAuth":
+			auth := conf.RegistryAuth
+			if auth.Password != "" {
+				auth.Password = redacted
+			}
+			if auth.RegistryToken != "" {
+				auth.RegistryToken = redacted
+			}
+			out[name] = auth
+		case name == "WebhookSecret":
+			if conf.WebhookSecret != "" {
+				out[name] = redacted
+			} else {
+				out[name] = ""
+			}
+		case field.Kind() == reflect.Func || field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface:
+			out[name] = !field.IsNil()
+		case name == "PerContainerOverrides":
+			overrides := []map[string]interface{}{}
+			for _, o := range conf.PerContainerOverrides {
+				dump := redactedConfig(o.ControllerConfig)
+				dump["Index"] = o.Index
+				overrides = append(overrides, dump)
+			}
+			out[name] = overrides
+		default:
+			out[name] = field.Interface()
+		}
+	}
+
+	return out
+}
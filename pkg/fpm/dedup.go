@@ -0,0 +1,190 @@
+package fpm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// dedupMaxBody is the largest response body kept for answering duplicate requests.
+	dedupMaxBody = 64 << 10
+	// dedupMaxEntries limits the cached responses, requests over it are served without
+	// deduplication.
+	dedupMaxEntries = 1000
+)
+
+// dedupCache holds the responses by request key until DeduplicateCacheTTLMs has passed.
+type dedupCache struct {
+	entries sync.Map
+	size    int64
+}
+
+// dedupEntry is the response to a request. Duplicates arriving while the first request is
+// still being processed wait for done before reading the response.
+type dedupEntry struct {
+	done     chan struct{}
+	status   int
+	header   http.Header
+	body     []byte
+	complete bool
+}
+
+// dedupRecorder passes the response through to the client while keeping a copy of it.
+type dedupRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (d *dedupRecorder) WriteHeader(status int) {
+	if d.status == 0 {
+		d.status = status
+	}
+	d.ResponseWriter.WriteHeader(status)
+}
+
+func (d *dedupRecorder) Write(b []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	if !d.overflow && d.body.Len()+len(b) <= dedupMaxBody {
+		d.body.Write(b)
+	} else {
+		d.overflow = true
+	}
+
+	return d.ResponseWriter.Write(b)
+}
+
+// dedupKey scopes the request ID to the request and the client sending it, so that an ID
+// can't be used to fetch the response of another client.
+func (s *ReqController) dedupKey(r *http.Request, id string) string {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+
+	h := sha256.New()
+	for _, part := range []string{id, r.Method, r.Host, r.URL.RequestURI(), client, r.Header.Get("Authorization"), r.Header.Get("Cookie")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// route sends the request to the containers, deduplicating it first when configured. CORS
+// preflights are answered here, so they pass the middleware chain like other requests. It's
+// the innermost handler of the middleware chain.
+func (s *ReqController) route(w http.ResponseWriter, r *http.Request) {
+	if s.Config.CORSConfig != nil && r.Method == http.MethodOptions {
+		s.preflight(w, r)
+		return
+	}
+	if s.dedup != nil {
+		s.serveDeduplicated(w, r, s.proxy)
+		return
+	}
+
+	s.proxy(w, r)
+}
+
+// serveDeduplicated answers requests repeating an earlier request ID with the cached
+// response, keeping non-idempotent endpoints from processing retried requests twice.
+func (s *ReqController) serveDeduplicated(w http.ResponseWriter, r *http.Request, serve http.HandlerFunc) {
+	id := r.Header.Get(s.Config.DeduplicateRequestIDHeader)
+	if id == "" {
+		serve(w, r)
+		return
+	}
+
+	cache := s.dedup
+	key := s.dedupKey(r, id)
+	for {
+		if atomic.LoadInt64(&cache.size) >= dedupMaxEntries {
+			if existing, ok := cache.entries.Load(key); ok {
+				if s.replay(w, r, existing.(*dedupEntry)) {
+					return
+				}
+				continue
+			}
+			serve(w, r)
+			return
+		}
+
+		entry := &dedupEntry{done: make(chan struct{})}
+		existing, loaded := cache.entries.LoadOrStore(key, entry)
+		if !loaded {
+			atomic.AddInt64(&cache.size, 1)
+			s.record(w, r, cache, key, entry, serve)
+			return
+		}
+		if s.replay(w, r, existing.(*dedupEntry)) {
+			return
+		}
+	}
+}
+
+// replay waits for the first request to finish and answers with its response. False is
+// returned if the response couldn't be cached and the request has to be processed.
+func (s *ReqController) replay(w http.ResponseWriter, r *http.Request, cached *dedupEntry) bool {
+	select {
+	case <-cached.done:
+	case <-r.Context().Done():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	}
+	if !cached.complete {
+		return false
+	}
+
+	copyHeader(w.Header(), cached.header)
+	w.WriteHeader(cached.status)
+	w.Write(cached.body)
+	return true
+}
+
+func (s *ReqController) record(w http.ResponseWriter, r *http.Request, cache *dedupCache, key string, entry *dedupEntry, serve http.HandlerFunc) {
+	forget := func() {
+		if cache.entries.CompareAndDelete(key, entry) {
+			atomic.AddInt64(&cache.size, -1)
+		}
+	}
+
+	rec := &dedupRecorder{ResponseWriter: w}
+	defer func() {
+		// Server errors are worth retrying, so they aren't kept.
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError || rec.overflow {
+			forget()
+			close(entry.done)
+			return
+		}
+
+		entry.status = rec.status
+		entry.header = w.Header().Clone()
+		// Cookies belong to the client that got them first.
+		entry.header.Del("Set-Cookie")
+		entry.body = rec.body.Bytes()
+		entry.complete = true
+		close(entry.done)
+
+		time.AfterFunc(time.Duration(s.Config.DeduplicateCacheTTLMs)*time.Millisecond, forget)
+	}()
+
+	serve(rec, r)
+}
+
+func newDedupCache(conf ControllerConfig) *dedupCache {
+	if conf.DeduplicateRequestIDHeader == "" {
+		return nil
+	}
+
+	return &dedupCache{}
+}
@@ -0,0 +1,148 @@
+package fpm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDocker serves the parts of the Docker API the controller uses to manage containers.
+// Containers get 127.0.0.1 as their address, so the deployment's port decides what the
+// readiness probes and requests reach.
+type fakeDocker struct {
+	lock       sync.Mutex
+	containers map[string]*fakeContainer
+	created    int
+}
+
+type fakeContainer struct {
+	name    string
+	running bool
+	// Filesystem changes reported by the diff endpoint
+	changes []map[string]interface{}
+	// Body of the create request
+	create map[string]interface{}
+}
+
+var apiVersion = regexp.MustCompile(`^/v[0-9.]+`)
+
+// newFakeDocker starts the fake daemon and points the Docker client of the test at it.
+func newFakeDocker(t *testing.T) *fakeDocker {
+	t.Helper()
+
+	d := &fakeDocker{containers: map[string]*fakeContainer{}}
+	server := httptest.NewServer(d)
+	t.Cleanup(server.Close)
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+
+	return d
+}
+
+func (d *fakeDocker) running() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	running := 0
+	for _, c := range d.containers {
+		if c.running {
+			running++
+		}
+	}
+
+	return running
+}
+
+// createRequest returns the body of the create request of the container with the given name.
+func (d *fakeDocker) createRequest(name string) map[string]interface{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, c := range d.containers {
+		if c.name == name {
+			return c.create
+		}
+	}
+
+	return nil
+}
+
+func (d *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	path := apiVersion.ReplaceAllString(r.URL.Path, "")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case path == "/events":
+		// Nothing happens to the containers, so the stream stays open without events.
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		d.lock.Unlock()
+		<-r.Context().Done()
+		d.lock.Lock()
+	case parts[0] == "images" && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{"Id": "sha256:fake", "Config": map[string]interface{}{}})
+	case path == "/containers/create":
+		d.created++
+		id := fmt.Sprintf("%064d", d.created)
+		c := &fakeContainer{name: r.URL.Query().Get("name")}
+		json.NewDecoder(r.Body).Decode(&c.create)
+		d.containers[id] = c
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"Id": id})
+	case parts[0] == "containers" && len(parts) >= 2:
+		c, ok := d.containers[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "No such container: " + parts[1]})
+			return
+		}
+		d.container(w, r, parts, c)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "not implemented: " + path})
+	}
+}
+
+func (d *fakeDocker) container(w http.ResponseWriter, r *http.Request, parts []string, c *fakeContainer) {
+	action := ""
+	if len(parts) > 2 {
+		action = parts[2]
+	}
+
+	switch {
+	case r.Method == http.MethodDelete:
+		delete(d.containers, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case action == "json":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":              parts[1],
+			"Name":            "/" + c.name,
+			"Created":         time.Now().Format(time.RFC3339Nano),
+			"State":           map[string]interface{}{"Running": c.running},
+			"Config":          map[string]interface{}{},
+			"NetworkSettings": map[string]interface{}{"IPAddress": "127.0.0.1"},
+		})
+	case action == "start":
+		c.running = true
+		w.WriteHeader(http.StatusNoContent)
+	case action == "kill" || action == "stop":
+		c.running = false
+		w.WriteHeader(http.StatusNoContent)
+	case action == "changes":
+		json.NewEncoder(w).Encode(c.changes)
+	case action == "wait":
+		json.NewEncoder(w).Encode(map[string]interface{}{"StatusCode": 0})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"message": "not implemented: " + action})
+	}
+}
@@ -0,0 +1,129 @@
+package fpm
+
+import (
+	"fmt"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"time"
+)
+
+// ReadinessTimeoutError is returned when a container doesn't start accepting connections
+// within the configured readiness timeout.
+type ReadinessTimeoutError struct {
+	ContainerID    string
+	DeploymentName string
+	Timeout        time.Duration
+	OriginalError  error
+}
+
+func (e *ReadinessTimeoutError) Error() string {
+	return fmt.Sprintf("Container %s of deployment %s was not ready within %s: %s", docker.ShortID(e.ContainerID), e.DeploymentName, e.Timeout, e.OriginalError)
+}
+
+func (e *ReadinessTimeoutError) Unwrap() error {
+	return e.OriginalError
+}
+
+// ConfigValidationError is returned when a ControllerConfig is not valid.
+type ConfigValidationError struct {
+	DeploymentName string
+	Message        string
+}
+
+func (e *ConfigValidationError) Error() string {
+	return fmt.Sprintf("Invalid configuration for deployment %s: %s", e.DeploymentName, e.Message)
+}
+
+func configError(conf ControllerConfig, format string, args ...interface{}) error {
+	return &ConfigValidationError{
+		DeploymentName: conf.Deployment,
+		Message:        fmt.Sprintf(format, args...),
+	}
+}
+
+// DeploymentError is returned when an operation on a deployment fails. ContainerID is set
+// when the operation concerned a specific container.
+type DeploymentError struct {
+	Message        string
+	DeploymentName string
+	ContainerID    string
+	OriginalError  error
+}
+
+func (e *DeploymentError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.OriginalError)
+}
+
+func (e *DeploymentError) Unwrap() error {
+	return e.OriginalError
+}
+
+// Cause allows pkg/errors to see the underlying error.
+func (e *DeploymentError) Cause() error {
+	return e.OriginalError
+}
+
+func deploymentError(deployment, containerID string, err error, format string, args ...interface{}) error {
+	return &DeploymentError{
+		Message:        fmt.Sprintf(format, args...),
+		DeploymentName: deployment,
+		ContainerID:    containerID,
+		OriginalError:  err,
+	}
+}
+
+func (s *ReqController) deploymentError(err error, format string, args ...interface{}) error {
+	return deploymentError(s.Config.Deployment, "", err, format, args...)
+}
+
+func (s *ReqController) containerError(id string, err error, format string, args ...interface{}) error {
+	return deploymentError(s.Config.Deployment, id, err, format, args...)
+}
+
+// ServerError is returned when the FCGI server can't be set up.
+type ServerError struct {
+	Message       string
+	OriginalError error
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.OriginalError)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.OriginalError
+}
+
+func (e *ServerError) Cause() error {
+	return e.OriginalError
+}
+
+func serverError(err error, format string, args ...interface{}) error {
+	return &ServerError{
+		Message:       fmt.Sprintf(format, args...),
+		OriginalError: err,
+	}
+}
+
+// ProxyError is returned by RoundTrip when a request can't be proxied to a container.
+// StatusCode is the HTTP status ServeHTTP responds with.
+type ProxyError struct {
+	StatusCode     int
+	DeploymentName string
+	OriginalError  error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("Unable to proxy request to deployment %s (%d): %s", e.DeploymentName, e.StatusCode, e.OriginalError)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.OriginalError
+}
+
+func (s *ReqController) proxyError(status int, err error) error {
+	return &ProxyError{
+		StatusCode:     status,
+		DeploymentName: s.Config.Deployment,
+		OriginalError:  err,
+	}
+}
@@ -0,0 +1,91 @@
+package fpm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfigValidationErrorAs(t *testing.T) {
+	conf := DefaultConfig("test", "php", "fpm", 9000)
+	conf.Type = "bogus"
+
+	_, err := NewReqController(conf)
+	var confErr *ConfigValidationError
+	if !errors.As(err, &confErr) {
+		t.Fatalf("expected ConfigValidationError, got %T: %s", err, err)
+	}
+	if confErr.DeploymentName != "test" {
+		t.Errorf("unexpected deployment %s", confErr.DeploymentName)
+	}
+}
+
+func TestReadinessTimeoutErrorAs(t *testing.T) {
+	// The backend is closed right away, so that nothing answers on its port.
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backend.Close()
+	s := newTestController(t, backend, func(conf *ControllerConfig) {
+		conf.ReadinessTimeoutSeconds = 1
+	})
+
+	err := s.waitUntilReady(s.pool.Members()[0], nil)
+	var timeoutErr *ReadinessTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected ReadinessTimeoutError, got %T: %s", err, err)
+	}
+	if timeoutErr.ContainerID != "test" || timeoutErr.DeploymentName != "test" || timeoutErr.OriginalError == nil {
+		t.Errorf("unexpected fields %+v", timeoutErr)
+	}
+}
+
+func TestDeploymentErrorAs(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+	s := newTestController(t, backend, nil)
+	invalid := s.Config
+	invalid.Type = "bogus"
+
+	err := s.Swap(invalid)
+	var deploymentErr *DeploymentError
+	if !errors.As(err, &deploymentErr) {
+		t.Fatalf("expected DeploymentError, got %T: %s", err, err)
+	}
+	if deploymentErr.DeploymentName != "test" {
+		t.Errorf("unexpected deployment %s", deploymentErr.DeploymentName)
+	}
+	var confErr *ConfigValidationError
+	if !errors.As(err, &confErr) {
+		t.Error("expected the cause to be a ConfigValidationError")
+	}
+}
+
+func TestServerErrorAs(t *testing.T) {
+	t.Setenv(ListenPortEnv, "not a port")
+
+	err := NewTCPFCGIServerFromEnv(DefaultConfig("test", "php", "fpm", 9000))
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		t.Fatalf("expected ServerError, got %T: %s", err, err)
+	}
+	if serverErr.OriginalError == nil {
+		t.Error("expected the original error to be kept")
+	}
+}
+
+func TestProxyErrorAs(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+	s := newTestController(t, backend, func(conf *ControllerConfig) {
+		conf.AllowedMethods = []string{http.MethodGet}
+	})
+
+	_, err := s.RoundTrip(httptest.NewRequest(http.MethodPost, "/", nil))
+	var proxyErr *ProxyError
+	if !errors.As(err, &proxyErr) {
+		t.Fatalf("expected ProxyError, got %T: %s", err, err)
+	}
+	if proxyErr.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", proxyErr.StatusCode)
+	}
+}
@@ -0,0 +1,135 @@
+package fpm
+
+import (
+	"context"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"sync/atomic"
+	"time"
+)
+
+const eventResubscribeDelay = 5 * time.Second
+
+// defaultNetwork is the network containers are attached to without NetworkName.
+const defaultNetwork = "bridge"
+
+// failureEvents are the container events that mean the container can't serve requests anymore.
+var failureEvents = map[string]bool{
+	"die":  true,
+	"oom":  true,
+	"kill": true,
+}
+
+// watchEvents marks containers dirty as soon as Docker reports them failing, instead of
+// waiting for a request to fail.
+func (s *ReqController) watchEvents() {
+	defer s.background.Done()
+
+	s.watch(func(ctx context.Context) (<-chan docker.ContainerEvent, error) {
+		return s.DockerCli.SubscribeEvents(ctx, s.Config.Deployment)
+	}, s.handleEvent)
+}
+
+// watchNetwork updates container addresses when containers get reconnected to the network,
+// e.g. after a daemon restart, instead of routing requests to stale addresses.
+func (s *ReqController) watchNetwork() {
+	defer s.background.Done()
+
+	network := s.Config.NetworkName
+	if network == "" {
+		network = defaultNetwork
+	}
+	s.watch(func(ctx context.Context) (<-chan docker.ContainerEvent, error) {
+		return s.DockerCli.SubscribeNetworkEvents(ctx, network)
+	}, s.handleNetworkEvent)
+}
+
+// watch passes events to handle until the controller is closed. The subscription is renewed
+// if the event stream ends, e.g. when the daemon restarts.
+func (s *ReqController) watch(subscribe func(ctx context.Context) (<-chan docker.ContainerEvent, error), handle func(docker.ContainerEvent)) {
+	stop := s.stop
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		events, err := subscribe(ctx)
+		if err == nil {
+			for event := range events {
+				handle(event)
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(eventResubscribeDelay):
+		}
+	}
+}
+
+func (s *ReqController) recordOOMKill(c *Container) {
+	atomic.AddInt64(&c.OOMKillCount, 1)
+	oomKills.WithLabelValues(s.Config.Deployment, c.Name).Inc()
+}
+
+// handleEvent marks the container dirty on failure events. Containers stopped or removed by
+// the controller itself are no longer started, or in the pool, by the time the lock is free.
+func (s *ReqController) handleEvent(event docker.ContainerEvent) {
+	if !failureEvents[event.Type] {
+		return
+	}
+
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	for _, c := range s.pool.Members() {
+		if c.Id == event.ContainerID && event.Type == "oom" {
+			s.recordOOMKill(c)
+		}
+		if c.Id == event.ContainerID && c.Started && !c.Dirty {
+			s.logger().Warn("container reported by Docker, marking it dirty", "deployment", s.Config.Deployment, "name", c.Name, "event", event.Type)
+			s.setContainerDirty(c.Id)
+			return
+		}
+	}
+}
+
+// handleNetworkEvent refreshes the address of a container connected to the network.
+func (s *ReqController) handleNetworkEvent(event docker.ContainerEvent) {
+	if event.Type != "connect" {
+		return
+	}
+
+	s.Lock.RLock()
+	var target *Container
+	for _, c := range s.pool.Members() {
+		if c.Id == event.ContainerID {
+			target = c
+		}
+	}
+	s.Lock.RUnlock()
+	if target == nil {
+		return
+	}
+
+	details, err := s.DockerCli.ContainerDetails(event.ContainerID)
+	if err != nil {
+		s.logger().Warn("unable to refresh container address", "deployment", s.Config.Deployment, "name", target.Name, "error", err)
+		return
+	}
+	ip := s.containerIP(details)
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	if ip != "" && ip != target.IPAddr && target.Started {
+		s.logger().Info("container address changed", "deployment", s.Config.Deployment, "name", target.Name, "old", target.IPAddr, "new", ip)
+		target.IPAddr = ip
+	}
+}
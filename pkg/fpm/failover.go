@@ -0,0 +1,100 @@
+package fpm
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// FailoverHeader is set on responses served by the fallback pool of a failover deployment.
+const FailoverHeader = "X-FPM-Failover"
+
+// failoverState holds the fallback pool of a failover deployment, created on first use.
+type failoverState struct {
+	lock       sync.Mutex
+	controller *ReqController
+}
+
+// fallbackConfig returns the configuration of the fallback pool: a single container of the
+// fallback image, started right away.
+func (c ControllerConfig) fallbackConfig() ControllerConfig {
+	conf := c
+	conf.Deployment = fmt.Sprintf("%s-failover", c.Deployment)
+	conf.Type = StaticController
+	conf.ContainerImage = c.FallbackImage
+	conf.ContainerImageTag = c.FallbackTag
+	if conf.ContainerImageTag == "" {
+		conf.ContainerImageTag = "latest"
+	}
+	conf.ContainerAmount = 1
+	conf.MinContainers = 0
+	conf.PerContainerOverrides = nil
+	conf.LocalCacheTag = ""
+	conf.ContainerNameFunc = nil
+	conf.DependsOn = nil
+	conf.FallbackImage = ""
+	conf.FallbackTag = ""
+
+	return conf
+}
+
+// fallbackController returns the fallback pool, initializing it if needed. A failed
+// initialization is retried by the next request.
+func (s *ReqController) fallbackController() (*ReqController, error) {
+	s.failover.lock.Lock()
+	defer s.failover.lock.Unlock()
+
+	if s.failover.controller != nil {
+		return s.failover.controller, nil
+	}
+
+	fallback, err := NewReqController(s.Config.fallbackConfig())
+	if err != nil {
+		return nil, err
+	}
+	if err := fallback.Init(); err != nil {
+		fallback.Close()
+		return nil, err
+	}
+	s.logger().Warn("no available containers, started failover pool", "deployment", s.Config.Deployment, "failover", fallback.Config.Deployment)
+
+	s.failover.controller = &fallback
+	return s.failover.controller, nil
+}
+
+// roundTripFallback proxies the request to the fallback pool and marks the response with
+// FailoverHeader.
+func (s *ReqController) roundTripFallback(r *http.Request) (*http.Response, error) {
+	fallback, err := s.fallbackController()
+	if err != nil {
+		return nil, s.proxyError(http.StatusServiceUnavailable, s.deploymentError(err, "Unable to start failover pool"))
+	}
+
+	res, err := fallback.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	res.Header.Set(FailoverHeader, "true")
+
+	return res, nil
+}
+
+// closeFallback closes the fallback pool if it has been started.
+func (s *ReqController) closeFallback() error {
+	if s.failover == nil {
+		return nil
+	}
+
+	s.failover.lock.Lock()
+	defer s.failover.lock.Unlock()
+
+	if s.failover.controller == nil {
+		return nil
+	}
+	if err := s.failover.controller.Close(); err != nil {
+		return s.deploymentError(err, "Unable to close failover pool")
+	}
+	s.failover.controller = nil
+
+	return nil
+}
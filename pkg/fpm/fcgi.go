@@ -2,75 +2,173 @@ package fpm
 
 import (
 	"fmt"
-	"github.com/pkg/errors"
+	fpmtls "github.com/ajmyyra/docker-fpm/pkg/tls"
 	"net"
 	"net/http/fcgi"
 	"os"
 	"os/user"
 	"strconv"
+	"time"
 )
 
+type ServerConfig struct {
+	// Maximum amount of simultaneous FCGI connections. Further connections wait to be
+	// accepted until earlier ones are closed. Zero means no limit.
+	MaxConcurrentFCGIConnections int
+	// Maximum rate of Docker API calls shared by all deployments of a Server. Zero means no limit.
+	GlobalDockerCallsPerSecond int
+	// Idle HTTP connections the proxy keeps open to each container for reuse between
+	// requests. Go's default of 2 makes busy containers open a new connection for most
+	// requests. Zero keeps the default. This only concerns connections to the containers: FCGI
+	// connections from the web server are kept open by the web server, e.g. with
+	// fastcgi_keep_conn in nginx, and can't be pooled from this side.
+	BackendIdleConnsPerContainer int
+	// With MaxConcurrentFCGIConnections, connections waiting for a free slot longer than this
+	// are closed, so that the web server gets an error before its own read timeout. Zero
+	// leaves them waiting in the listen backlog instead.
+	AcceptTimeoutSeconds int
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		MaxConcurrentFCGIConnections: 256,
+	}
+}
+
+func (c ServerConfig) acceptTimeout() time.Duration {
+	return time.Duration(c.AcceptTimeoutSeconds) * time.Second
+}
+
+// NewSocketFCGIServer serves the deployment on a unix socket at path, owned by owner and
+// group, with DefaultServerConfig.
 func NewSocketFCGIServer(config ControllerConfig, path, owner, group string) error {
+	return NewSocketFCGIServerWithConfig(DefaultServerConfig(), config, path, owner, group)
+}
+
+// NewSocketFCGIServerWithConfig serves the deployment on a unix socket at path, owned by
+// owner and group. When started through systemd socket activation, the inherited socket is
+// used instead.
+func NewSocketFCGIServerWithConfig(server ServerConfig, config ControllerConfig, path, owner, group string) error {
+	inherited, err := SystemdListener()
+	if err != nil {
+		return err
+	}
+	if inherited != nil {
+		defer inherited.Close()
+		return NewSocketFCGIServerWithListener(server, config, inherited)
+	}
+
 	usr, err := user.Lookup(owner)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to find user %s", owner))
+		return serverError(err, "Unable to find user %s", owner)
 	}
 	userId, err := strconv.Atoi(usr.Uid)
 	if err != nil {
-		return errors.Wrap(err, "User ID is not a number")
+		return serverError(err, "User ID is not a number")
 	}
 
 	grp, err := user.LookupGroup(group)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to find group %s", group))
+		return serverError(err, "Unable to find group %s", group)
 	}
 	groupId, err := strconv.Atoi(grp.Gid)
 	if err != nil {
-		return errors.Wrap(err, "Group ID is not a number")
+		return serverError(err, "Group ID is not a number")
 	}
 
 	l, err := net.Listen("unix", path)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to listen on %s", path))
+		return serverError(err, "Unable to listen on %s", path)
 	}
 
 	defer l.Close()
 	defer os.Remove(path)
 
 	if err := os.Chown(path, userId, groupId); err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to change socker file ownership to %s:%s", owner, group))
+		return serverError(err, "Unable to change socker file ownership to %s:%s", owner, group)
 	}
 
+	return NewSocketFCGIServerWithListener(server, config, l)
+}
+
+// NewSocketFCGIServerWithListener serves the deployment on an existing listener, e.g. one
+// inherited from a parent process. The caller is responsible for closing the listener.
+func NewSocketFCGIServerWithListener(server ServerConfig, config ControllerConfig, l net.Listener) error {
 	h, err := NewReqController(config)
 	if err != nil {
-		return errors.Wrap(err, "Unable to setup request controller")
+		return serverError(err, "Unable to setup request controller")
 	}
+	h.setConnectionPoolSize(server.BackendIdleConnsPerContainer)
 	if err = h.Init(); err != nil {
-		return errors.Wrap(err, "Unable to initialize request controller")
+		return serverError(err, "Unable to initialize request controller")
 	}
 
-	fcgi.Serve(l, &h)
-	// TODO make sure socket is closed and removed and controller is shut down with Close() after interrupted
+	fcgi.Serve(newLimitListener(l, server.MaxConcurrentFCGIConnections, server.acceptTimeout()), &h)
+	// TODO make sure controller is shut down with Close() after interrupted
 
 	return nil
 }
 
+// NewTCPFCGIServer serves the deployment on ipAddr and port with DefaultServerConfig.
 func NewTCPFCGIServer(config ControllerConfig, ipAddr string, port int) error {
+	return NewTCPFCGIServerWithConfig(DefaultServerConfig(), config, ipAddr, port)
+}
+
+// NewTCPFCGIServerWithConfig serves the deployment on ipAddr and port.
+func NewTCPFCGIServerWithConfig(server ServerConfig, config ControllerConfig, ipAddr string, port int) error {
 	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", ipAddr, port))
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to listen on %s:%d", ipAddr, port))
+		return serverError(err, "Unable to listen on %s:%d", ipAddr, port)
 	}
 
 	h, err := NewReqController(config)
 	if err != nil {
-		return errors.Wrap(err, "Unable to setup request controller")
+		return serverError(err, "Unable to setup request controller")
 	}
+	h.setConnectionPoolSize(server.BackendIdleConnsPerContainer)
 	if err = h.Init(); err != nil {
-		return errors.Wrap(err, "Unable to initialize request controller")
+		return serverError(err, "Unable to initialize request controller")
 	}
 
-	fcgi.Serve(l, &h)
+	fcgi.Serve(newLimitListener(l, server.MaxConcurrentFCGIConnections, server.acceptTimeout()), &h)
 	// TODO make sure controller is shut down with Close() after interrupted
 
 	return nil
 }
+
+// Environment variables read by NewTCPFCGIServerFromEnv
+const (
+	ListenAddrEnv = "FPM_LISTEN_ADDR"
+	ListenPortEnv = "FPM_LISTEN_PORT"
+)
+
+const defaultListenPort = 9000
+
+// NewTCPFCGIServerFromEnv serves the deployment like NewTCPFCGIServer, listening on
+// FPM_LISTEN_ADDR (all interfaces by default) and FPM_LISTEN_PORT (9000 by default). Backend
+// TLS is configured from the environment when the config doesn't have it, see
+// tls.NewBackendTLSConfigFromEnv.
+func NewTCPFCGIServerFromEnv(config ControllerConfig) error {
+	addr := os.Getenv(ListenAddrEnv)
+	if addr == "" {
+		addr = "0.0.0.0"
+	}
+
+	port := defaultListenPort
+	if p := os.Getenv(ListenPortEnv); p != "" {
+		var err error
+		if port, err = strconv.Atoi(p); err != nil {
+			return serverError(err, "Invalid %s", ListenPortEnv)
+		}
+	}
+
+	if config.BackendTLSConfig == nil {
+		tlsConf, err := fpmtls.NewBackendTLSConfigFromEnv()
+		if err != nil {
+			return err
+		}
+		config.BackendTLSConfig = tlsConf
+	}
+
+	return NewTCPFCGIServer(config, addr, port)
+}
@@ -0,0 +1,73 @@
+package fpm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the latency histogram buckets. Anything slower ends up in the overflow bucket.
+var latencyBuckets = []time.Duration{
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1000 * time.Millisecond,
+	2500 * time.Millisecond,
+	5000 * time.Millisecond,
+	10000 * time.Millisecond,
+}
+
+// LatencyHistogram counts request latencies into latencyBuckets, followed by an overflow
+// bucket. Remaining slots are unused. Counters must be accessed atomically.
+type LatencyHistogram [16]int64
+
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	bucket := len(latencyBuckets)
+	for i, bound := range latencyBuckets {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+
+	atomic.AddInt64(&h[bucket], 1)
+}
+
+// Percentile returns the upper bound of the bucket containing the p:th (0-100) percentile
+// of observed latencies. Values in the overflow bucket are reported as the largest bound.
+func (h *LatencyHistogram) Percentile(p float64) time.Duration {
+	var counts [len(h)]int64
+	var total int64
+	for i := range h {
+		counts[i] = atomic.LoadInt64(&h[i])
+		total += counts[i]
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	target := int64(float64(total) * p / 100)
+	if target < 1 {
+		target = 1
+	}
+
+	var cumulative int64
+	for i, bound := range latencyBuckets {
+		cumulative += counts[i]
+		if cumulative >= target {
+			return bound
+		}
+	}
+
+	return latencyBuckets[len(latencyBuckets)-1]
+}
+
+func (s *ReqController) observeLatency(c *Container, d time.Duration) {
+	c.LatencyHistogram.Observe(d)
+	backendLatency.WithLabelValues(s.Config.Deployment, c.Name).Observe(d.Seconds())
+}
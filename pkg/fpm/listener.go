@@ -0,0 +1,126 @@
+package fpm
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// limitListener blocks Accept while max connections are open, applying back-pressure to
+// the FCGI client instead of spawning an unbounded amount of connection goroutines.
+//
+// With an accept timeout, connections are accepted right away and wait for a free slot in
+// a queue instead. Ones waiting longer than the timeout are closed, so that the web server
+// gets an error before its own timeout.
+type limitListener struct {
+	net.Listener
+	sem           chan struct{}
+	acceptTimeout time.Duration
+	pending       chan pendingConn
+	start         *sync.Once
+}
+
+// pendingConn is an accepted connection waiting for a free slot. The timer closes it when
+// the accept timeout is reached.
+type pendingConn struct {
+	conn  net.Conn
+	timer *time.Timer
+	err   error
+}
+
+type limitConn struct {
+	net.Conn
+	release *sync.Once
+	sem     chan struct{}
+}
+
+func newLimitListener(l net.Listener, max int, acceptTimeout time.Duration) net.Listener {
+	if max <= 0 {
+		return l
+	}
+
+	return &limitListener{
+		Listener:      l,
+		sem:           make(chan struct{}, max),
+		acceptTimeout: acceptTimeout,
+		pending:       make(chan pendingConn, max),
+		start:         &sync.Once{},
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if l.acceptTimeout > 0 {
+		return l.acceptQueued()
+	}
+
+	l.sem <- struct{}{}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+
+	return &limitConn{
+		Conn:    conn,
+		release: &sync.Once{},
+		sem:     l.sem,
+	}, nil
+}
+
+// acceptQueued hands out the next queued connection that hasn't timed out yet.
+func (l *limitListener) acceptQueued() (net.Conn, error) {
+	l.start.Do(func() {
+		go l.queueConns()
+	})
+
+	l.sem <- struct{}{}
+	for {
+		p := <-l.pending
+		if p.err != nil {
+			<-l.sem
+			return nil, p.err
+		}
+		// The timer has already closed the connection.
+		if !p.timer.Stop() {
+			continue
+		}
+
+		return &limitConn{
+			Conn:    p.conn,
+			release: &sync.Once{},
+			sem:     l.sem,
+		}, nil
+	}
+}
+
+// queueConns accepts connections to the queue until the listener is closed.
+func (l *limitListener) queueConns() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.pending <- pendingConn{err: err}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		timer := time.AfterFunc(l.acceptTimeout, func() {
+			slog.Warn("closing connection after waiting for a free slot", "remote", conn.RemoteAddr().String(), "timeout", l.acceptTimeout)
+			conn.Close()
+		})
+		l.pending <- pendingConn{conn: conn, timer: timer}
+	}
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.release.Do(func() {
+		<-c.sem
+	})
+
+	return err
+}
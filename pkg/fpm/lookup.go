@@ -0,0 +1,75 @@
+package fpm
+
+import (
+	"maps"
+	"sync/atomic"
+)
+
+// ContainerByName returns a copy of the deployment's container with the given name.
+func (s *ReqController) ContainerByName(name string) (Container, bool) {
+	return s.findContainer(func(c *Container) bool {
+		return c.Name == name
+	})
+}
+
+// ContainerByID returns a copy of the deployment's container with the given ID.
+func (s *ReqController) ContainerByID(id string) (Container, bool) {
+	return s.findContainer(func(c *Container) bool {
+		return c.Id == id
+	})
+}
+
+// ContainerSnapshots returns copies of the deployment's containers. Unlike the containers in
+// the pool, they're safe to read while requests are being served.
+func (s *ReqController) ContainerSnapshots() []Container {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	all := []Container{}
+	for _, c := range s.pool.Members() {
+		all = append(all, c.snapshot())
+	}
+
+	return all
+}
+
+func (s *ReqController) findContainer(match func(c *Container) bool) (Container, bool) {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	for _, c := range s.pool.Members() {
+		if match(c) {
+			return c.snapshot(), true
+		}
+	}
+
+	return Container{}, false
+}
+
+// snapshot copies the container, reading the fields updated during requests atomically.
+func (c *Container) snapshot() Container {
+	cp := Container{
+		Name:         c.Name,
+		Id:           c.Id,
+		Started:      c.Started,
+		Dirty:        c.Dirty,
+		IPAddr:       c.IPAddr,
+		ExtraPorts:   maps.Clone(c.ExtraPorts),
+		ActiveReqs:   atomic.LoadInt64(&c.ActiveReqs),
+		RequestCount: atomic.LoadInt64(&c.RequestCount),
+		Mounts:       append([]string(nil), c.Mounts...),
+		StartedAt:    c.StartedAt,
+		CreatedAt:    c.CreatedAt,
+		Paused:       c.Paused,
+		HostPorts:    maps.Clone(c.HostPorts),
+		OOMKillCount: atomic.LoadInt64(&c.OOMKillCount),
+		NetRxBytes:   atomic.LoadUint64(&c.NetRxBytes),
+		NetTxBytes:   atomic.LoadUint64(&c.NetTxBytes),
+		RestartCount: c.RestartCount,
+	}
+	for i := range c.LatencyHistogram {
+		cp.LatencyHistogram[i] = atomic.LoadInt64(&c.LatencyHistogram[i])
+	}
+
+	return cp
+}
@@ -0,0 +1,57 @@
+package fpm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestContainerLookupCopiesAllFields(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	s := newTestController(t, backend, nil)
+	c := s.pool.Members()[0]
+	c.Dirty = true
+	c.ExtraPorts = map[string]int{"9001/tcp": 9001}
+	c.LatencyHistogram[0] = 1
+	c.ActiveReqs = 2
+	c.RequestCount = 3
+	c.Mounts = []string{"sessions"}
+	c.StartedAt = time.Now()
+	c.CreatedAt = time.Now()
+	c.Paused = true
+	c.HostPorts = map[int]int{9000: 32768}
+	c.OOMKillCount = 4
+	c.NetRxBytes = 5
+	c.NetTxBytes = 6
+	c.RestartCount = 7
+
+	byName, ok := s.ContainerByName("test")
+	if !ok {
+		t.Fatal("container not found by name")
+	}
+	byID, ok := s.ContainerByID("test")
+	if !ok {
+		t.Fatal("container not found by ID")
+	}
+	snapshots := s.ContainerSnapshots()
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(snapshots))
+	}
+
+	for name, cp := range map[string]Container{"ContainerByName": byName, "ContainerByID": byID, "ContainerSnapshots": snapshots[0]} {
+		v := reflect.ValueOf(cp)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.IsExported() && v.Field(i).IsZero() {
+				t.Errorf("%s: field %s wasn't copied", name, field.Name)
+			}
+		}
+		if cp.RestartCount != 7 {
+			t.Errorf("%s: expected 7 restarts, got %d", name, cp.RestartCount)
+		}
+	}
+}
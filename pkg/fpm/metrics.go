@@ -0,0 +1,43 @@
+package fpm
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var backendLatency = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "fpm_backend_request_duration_seconds",
+		Help:    "Round-trip latency of requests proxied to deployment containers.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	},
+	[]string{"deployment", "container"},
+)
+
+var queueDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "fpm_queue_depth",
+		Help: "Requests waiting in the deployment queue for an available container.",
+	},
+	[]string{"deployment"},
+)
+
+var selectionLatency = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "fpm_container_selection_duration_seconds",
+		Help:    "Time spent selecting a container for a request.",
+		Buckets: []float64{0.0001, 0.001, 0.01, 0.1},
+	},
+	[]string{"deployment", "strategy"},
+)
+
+var oomKills = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "fpm_container_oom_kills_total",
+		Help: "Containers killed for running out of memory.",
+	},
+	[]string{"deployment", "container"},
+)
+
+func init() {
+	prometheus.MustRegister(backendLatency, queueDepth, selectionLatency, oomKills)
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/time/rate"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a handler with additional behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with the middleware, the first one being the outermost.
+func Chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// statusWriter records the status and size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// WithAccessLog writes a line for every request to w. The format supports the placeholders
+// %a (remote address), %m (method), %u (request URI), %s (status), %b (response bytes) and
+// %d (duration).
+func WithAccessLog(w io.Writer, format string) Middleware {
+	var lock sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: rw}
+			next.ServeHTTP(sw, r)
+
+			line := strings.NewReplacer(
+				"%a", r.RemoteAddr,
+				"%m", r.Method,
+				"%u", r.RequestURI,
+				"%s", strconv.Itoa(sw.status),
+				"%b", strconv.Itoa(sw.bytes),
+				"%d", time.Since(start).String(),
+			).Replace(format)
+
+			lock.Lock()
+			defer lock.Unlock()
+			fmt.Fprintln(w, line)
+		})
+	}
+}
+
+// WithRateLimit answers requests exceeding rps requests per second with 429.
+func WithRateLimit(rps int) Middleware {
+	limiter := rate.NewLimiter(rate.Limit(rps), rps)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.Allow() {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithRequestID makes sure every request has an ID in the given header, generating one if the
+// client didn't send it. The ID is also returned in the response.
+func WithRequestID(header string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if id == "" {
+				buf := make([]byte, 16)
+				if _, err := rand.Read(buf); err == nil {
+					id = hex.EncodeToString(buf)
+					r.Header.Set(header, id)
+				}
+			}
+			if id != "" {
+				w.Header().Set(header, id)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WithRecovery turns panics in the handler chain into 500 responses, logging them to log.
+func WithRecovery(log *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					log.Error("panic while handling request", "method", r.Method, "uri", r.RequestURI, "panic", rec)
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package fpm
+
+import (
+	"github.com/ajmyyra/docker-fpm/pkg/webhook"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const webhookTimeout = 5 * time.Second
+const webhookMaxAttempts = 3
+
+const subscriberBuffer = 64
+
+// subscribers holds the channels lifecycle events are published to.
+type subscribers struct {
+	lock     *sync.Mutex
+	channels map[chan webhook.Event]struct{}
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{
+		lock:     &sync.Mutex{},
+		channels: map[chan webhook.Event]struct{}{},
+	}
+}
+
+// Subscribe returns a channel receiving the deployment's lifecycle events, the same ones
+// sent as webhooks, and a function for unsubscribing. Events are dropped for subscribers
+// that don't keep up.
+func (s *ReqController) Subscribe() (<-chan webhook.Event, func()) {
+	ch := make(chan webhook.Event, subscriberBuffer)
+
+	s.subscribers.lock.Lock()
+	s.subscribers.channels[ch] = struct{}{}
+	s.subscribers.lock.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.subscribers.lock.Lock()
+			delete(s.subscribers.channels, ch)
+			s.subscribers.lock.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (s *ReqController) publish(event webhook.Event) {
+	if s.subscribers == nil {
+		return
+	}
+
+	s.subscribers.lock.Lock()
+	defer s.subscribers.lock.Unlock()
+
+	for ch := range s.subscribers.channels {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// notify publishes an event about the container to subscribers and sends it as a webhook in
+// the background, so that callers holding the lock aren't slowed down by the receiving end.
+// c may be nil.
+func (s *ReqController) notify(eventType string, c *Container) {
+	event := webhook.Event{
+		Type:       eventType,
+		Deployment: s.Config.Deployment,
+		Time:       time.Now(),
+	}
+	if c != nil {
+		event.ContainerID = c.Id
+		event.ContainerName = c.Name
+	}
+
+	s.publish(event)
+	if s.webhook == nil {
+		return
+	}
+
+	go func() {
+		if err := s.webhook.SendWebhook(event); err != nil {
+			s.logger().Warn("unable to send webhook", "deployment", s.Config.Deployment, "event", eventType, "error", err)
+		}
+	}()
+}
+
+// notifyExhausted reports the pool running out of available containers, once per occurrence.
+func (s *ReqController) notifyExhausted(exhausted bool) {
+	if !exhausted {
+		atomic.StoreInt32(&s.exhausted, 0)
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.exhausted, 0, 1) {
+		s.notify(webhook.PoolExhausted, nil)
+	}
+}
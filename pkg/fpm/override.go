@@ -0,0 +1,68 @@
+package fpm
+
+import "reflect"
+
+// ContainerOverride replaces settings of the container at Index in the pool. Only non-zero
+// fields of the embedded config are applied. The fields that can be overridden are the ones
+// used when creating the container: ContainerImage, ContainerImageTag, ExtraLabels, Platform,
+// AttachStdin, TmpfsMounts, LogDriver and LogDriverOptions. Other settings, e.g. ports and
+// the network, decide how requests are routed and apply to the whole deployment.
+type ContainerOverride struct {
+	Index int
+	ControllerConfig
+}
+
+// overridableFields are the ControllerConfig fields a ContainerOverride may set.
+var overridableFields = map[string]bool{
+	"ContainerImage":    true,
+	"ContainerImageTag": true,
+	"ExtraLabels":       true,
+	"Platform":          true,
+	"AttachStdin":       true,
+	"TmpfsMounts":       true,
+	"LogDriver":         true,
+	"LogDriverOptions":  true,
+}
+
+// fixedField returns the name of a field set in the override that can't differ between the
+// containers of a deployment, or an empty string if there's none.
+func (o ContainerOverride) fixedField() string {
+	v := reflect.ValueOf(o.ControllerConfig)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if !overridableFields[name] && !v.Field(i).IsZero() {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// containerConfig returns the configuration for the container at the given pool index.
+func (s *ReqController) containerConfig(index int) ControllerConfig {
+	conf := s.Config
+	for _, o := range s.Config.PerContainerOverrides {
+		if o.Index == index {
+			conf = mergeConfig(conf, o.ControllerConfig)
+		}
+	}
+
+	return conf
+}
+
+// mergeConfig returns base with every non-zero field of override applied on top of it.
+func mergeConfig(base, override ControllerConfig) ControllerConfig {
+	merged := reflect.ValueOf(&base).Elem()
+	over := reflect.ValueOf(override)
+
+	for i := 0; i < over.NumField(); i++ {
+		if merged.Type().Field(i).Name == "PerContainerOverrides" {
+			continue
+		}
+		if field := over.Field(i); !field.IsZero() {
+			merged.Field(i).Set(field)
+		}
+	}
+
+	return base
+}
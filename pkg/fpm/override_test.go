@@ -0,0 +1,80 @@
+package fpm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContainerOverrideReachesDocker(t *testing.T) {
+	daemon := newFakeDocker(t)
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	conf := DefaultConfig("test", "php", "fpm", backendPort(t, backend))
+	conf.Type = StaticController
+	conf.ContainerAmount = 2
+	conf.PerContainerOverrides = []ContainerOverride{{
+		Index: 1,
+		ControllerConfig: ControllerConfig{
+			ContainerImageTag: "fpm-debug",
+			ExtraLabels:       map[string]string{"role": "debug"},
+			AttachStdin:       true,
+			TmpfsMounts:       map[string]string{"/tmp": "size=64m"},
+			LogDriver:         "none",
+		},
+	}}
+
+	s, err := NewReqController(conf)
+	if err != nil {
+		t.Fatalf("unable to create controller: %s", err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("unable to initialize controller: %s", err)
+	}
+	defer s.Close()
+
+	plain, overridden := daemon.createRequest("test-1"), daemon.createRequest("test-2")
+	if plain == nil || overridden == nil {
+		t.Fatal("expected both containers to be created")
+	}
+
+	if image := overridden["Image"]; image != "php:fpm-debug" {
+		t.Errorf("expected the overridden image, got %v", image)
+	}
+	if labels, _ := overridden["Labels"].(map[string]interface{}); labels["role"] != "debug" {
+		t.Errorf("expected the overridden labels, got %v", overridden["Labels"])
+	}
+	if overridden["AttachStdin"] != true {
+		t.Error("expected AttachStdin to be overridden")
+	}
+	host, _ := overridden["HostConfig"].(map[string]interface{})
+	if tmpfs, _ := host["Tmpfs"].(map[string]interface{}); tmpfs["/tmp"] != "size=64m" {
+		t.Errorf("expected the overridden tmpfs mounts, got %v", host["Tmpfs"])
+	}
+	if logConfig, _ := host["LogConfig"].(map[string]interface{}); logConfig["Type"] != "none" {
+		t.Errorf("expected the overridden log driver, got %v", host["LogConfig"])
+	}
+
+	if plain["Image"] != "php:fpm" || plain["AttachStdin"] == true {
+		t.Errorf("expected the override to apply only to its own container, got %v", plain)
+	}
+}
+
+func TestContainerOverrideOfDeploymentSettings(t *testing.T) {
+	for name, override := range map[string]ControllerConfig{
+		"ports":   {ContainerPort: 9001},
+		"network": {NetworkName: "other"},
+		"routing": {UseHostPorts: true},
+	} {
+		conf := DefaultConfig("test", "php", "fpm", 9000)
+		conf.PerContainerOverrides = []ContainerOverride{{Index: 0, ControllerConfig: override}}
+
+		_, err := NewReqController(conf)
+		var configErr *ConfigValidationError
+		if !errors.As(err, &configErr) {
+			t.Errorf("%s: expected a configuration error, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package fpm
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultFCGIParamMapper maps the request to the CGI/1.1 meta-variables (RFC 3875) that are
+// normally set by the web server in front of docker-fpm.
+func DefaultFCGIParamMapper(r *http.Request) map[string]string {
+	params := map[string]string{
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"REQUEST_METHOD":    r.Method,
+		"QUERY_STRING":      r.URL.RawQuery,
+		"REQUEST_URI":       r.URL.RequestURI(),
+		"SCRIPT_NAME":       r.URL.Path,
+		"SERVER_PROTOCOL":   r.Proto,
+		"SERVER_SOFTWARE":   "docker-fpm",
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		params["CONTENT_TYPE"] = ct
+	}
+	if r.ContentLength >= 0 {
+		params["CONTENT_LENGTH"] = strconv.FormatInt(r.ContentLength, 10)
+	}
+
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+		port = "80"
+		if r.TLS != nil {
+			port = "443"
+		}
+	}
+	params["SERVER_NAME"] = host
+	params["SERVER_PORT"] = port
+
+	if ip, remotePort, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		params["REMOTE_ADDR"] = ip
+		params["REMOTE_PORT"] = remotePort
+	} else {
+		params["REMOTE_ADDR"] = r.RemoteAddr
+	}
+
+	if r.TLS != nil {
+		params["HTTPS"] = "on"
+	}
+
+	return params
+}
+
+// cgiParams are the meta-variables of RFC 3875 and the common extensions of web servers.
+// CONTENT_TYPE and CONTENT_LENGTH are left out, as their headers describe the request body.
+var cgiParams = []string{
+	"AUTH_TYPE", "DOCUMENT_ROOT", "GATEWAY_INTERFACE", "HTTPS", "PATH_INFO", "PATH_TRANSLATED",
+	"QUERY_STRING", "REMOTE_ADDR", "REMOTE_HOST", "REMOTE_IDENT", "REMOTE_PORT", "REMOTE_USER",
+	"REQUEST_METHOD", "REQUEST_SCHEME", "REQUEST_URI", "SCRIPT_FILENAME", "SCRIPT_NAME",
+	"SERVER_ADDR", "SERVER_NAME", "SERVER_PORT", "SERVER_PROTOCOL", "SERVER_SOFTWARE",
+}
+
+// paramHeader converts a CGI meta-variable name to the header it's passed in, the reverse of
+// the HTTP_ naming of net/http/cgi: CONTENT_TYPE becomes Content-Type.
+func paramHeader(name string) string {
+	return http.CanonicalHeaderKey(strings.ReplaceAll(name, "_", "-"))
+}
+
+// injectParams sets the mapped parameters of the request as headers of the proxied request.
+// Headers named after parameters are dropped first, so that a client can't pass e.g. Https: on
+// for a parameter the mapper leaves unset.
+func (s *ReqController) injectParams(r *http.Request, proxyReq *http.Request) {
+	if s.Config.FCGIParamMapper == nil {
+		return
+	}
+
+	for _, name := range cgiParams {
+		proxyReq.Header.Del(paramHeader(name))
+	}
+	for name, value := range s.Config.FCGIParamMapper(r) {
+		proxyReq.Header.Set(paramHeader(name), value)
+	}
+}
@@ -0,0 +1,118 @@
+package fpm
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"github.com/pkg/errors"
+	"sync/atomic"
+)
+
+const (
+	running int32 = iota
+	paused
+	autoPaused
+)
+
+// Pause stops the deployment from serving requests, which are answered with 503 until
+// Resume is called. Containers are left running.
+func (s *ReqController) Pause() {
+	atomic.StoreInt32(&s.pauseState, paused)
+}
+
+func (s *ReqController) Resume() {
+	atomic.StoreInt32(&s.pauseState, running)
+}
+
+func (s *ReqController) IsPaused() bool {
+	return atomic.LoadInt32(&s.pauseState) != running
+}
+
+// pauseIfTooDirty pauses the deployment once MaxDirtyContainers containers are dirty, so
+// that clients get a clear 503 instead of 502s from whatever containers are left.
+func (s *ReqController) pauseIfTooDirty() {
+	if s.Config.MaxDirtyContainers <= 0 {
+		return
+	}
+
+	dirty := 0
+	for _, c := range s.pool.Members() {
+		if c.Dirty {
+			dirty++
+		}
+	}
+
+	if dirty >= s.Config.MaxDirtyContainers && atomic.CompareAndSwapInt32(&s.pauseState, running, autoPaused) {
+		s.logger().Error("too many dirty containers, pausing the deployment", "deployment", s.Config.Deployment, "dirty", dirty, "limit", s.Config.MaxDirtyContainers)
+	}
+}
+
+// resumeIfRecovered resumes an automatically paused deployment once it has healthy containers again.
+func (s *ReqController) resumeIfRecovered() {
+	if atomic.LoadInt32(&s.pauseState) != autoPaused {
+		return
+	}
+
+	for _, c := range s.pool.Members() {
+		if !c.Dirty {
+			atomic.CompareAndSwapInt32(&s.pauseState, autoPaused, running)
+			s.logger().Info("deployment has healthy containers again, resuming", "deployment", s.Config.Deployment)
+			return
+		}
+	}
+}
+
+// PauseContainer freezes the container in Docker and takes it out of routing, e.g. for
+// attaching a debugger, without affecting the rest of the pool. It isn't marked dirty.
+func (s *ReqController) PauseContainer(id string) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	c, err := s.pausableContainer(id)
+	if err != nil {
+		return err
+	}
+
+	// Taking it out of routing first, so that no new requests end up waiting on a frozen container.
+	c.Paused = true
+	if err := s.DockerCli.PauseContainer(context.Background(), c.Id); err != nil {
+		c.Paused = false
+		return err
+	}
+
+	return nil
+}
+
+// ResumeContainer unfreezes a container paused with PauseContainer and returns it to routing.
+func (s *ReqController) ResumeContainer(id string) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	c, err := s.pausableContainer(id)
+	if err != nil {
+		return err
+	}
+	if !c.Paused {
+		return nil
+	}
+
+	if err := s.DockerCli.UnpauseContainer(context.Background(), c.Id); err != nil {
+		return err
+	}
+	c.Paused = false
+
+	return nil
+}
+
+func (s *ReqController) pausableContainer(id string) (*Container, error) {
+	for _, c := range s.pool.Members() {
+		if c.Id == id {
+			if !c.Started {
+				return nil, errors.New(fmt.Sprintf("Container %s of deployment %s is not running", docker.ShortID(id), s.Config.Deployment))
+			}
+			return c, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("Container %s not found in deployment %s", docker.ShortID(id), s.Config.Deployment))
+}
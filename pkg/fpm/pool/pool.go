@@ -0,0 +1,125 @@
+package pool
+
+import (
+	"github.com/pkg/errors"
+	"math/rand"
+	"sync"
+)
+
+// Backend is a member of the pool requests are routed to.
+type Backend interface {
+	// ID identifies the backend for dirty tracking
+	ID() string
+	// Available tells if the backend can be handed out for requests
+	Available() bool
+	// Acquire and Release track requests in flight to the backend
+	Acquire()
+	Release()
+}
+
+// Selector picks an available backend among the members of the pool.
+type Selector[T Backend] func(members []T) (T, error)
+
+// Pool holds the backends of a deployment. The lock is shared with the owner of the pool,
+// who usually has to keep the pool unchanged over several operations: Get and GetWith take
+// the read lock themselves, while the rest of the methods expect the caller to hold it.
+type Pool[T Backend] struct {
+	lock    *sync.RWMutex
+	members []T
+	dirty   chan string
+}
+
+// New creates an empty pool guarded by lock, with room for dirtyQueue pending dirty
+// notifications.
+func New[T Backend](lock *sync.RWMutex, dirtyQueue int) *Pool[T] {
+	return &Pool[T]{
+		lock:    lock,
+		members: []T{},
+		dirty:   make(chan string, dirtyQueue),
+	}
+}
+
+func (p *Pool[T]) Members() []T {
+	return p.members
+}
+
+func (p *Pool[T]) Len() int {
+	return len(p.members)
+}
+
+func (p *Pool[T]) Add(member T) {
+	p.members = append(p.members, member)
+}
+
+// Replace swaps the member at index i with another one.
+func (p *Pool[T]) Replace(i int, member T) {
+	p.members[i] = member
+}
+
+// Set replaces all members of the pool.
+func (p *Pool[T]) Set(members []T) {
+	p.members = members
+}
+
+// Get hands out a random available backend. The returned function releases it and has to
+// be called once the request to the backend is done.
+func (p *Pool[T]) Get() (T, func(), error) {
+	return p.GetWith(Random[T])
+}
+
+// GetWith hands out the backend chosen by pick, like Get.
+func (p *Pool[T]) GetWith(pick Selector[T]) (T, func(), error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	chosen, err := pick(p.members)
+	if err != nil {
+		var none T
+		return none, nil, err
+	}
+
+	chosen.Acquire()
+	released := &sync.Once{}
+	return chosen, func() { released.Do(chosen.Release) }, nil
+}
+
+// MarkDirty reports a broken backend without blocking or locking. False is returned if the
+// dirty queue is full and the notification was dropped.
+func (p *Pool[T]) MarkDirty(id string) bool {
+	select {
+	case p.dirty <- id:
+		return true
+	default:
+		return false
+	}
+}
+
+// Dirty receives the IDs of backends reported with MarkDirty.
+func (p *Pool[T]) Dirty() <-chan string {
+	return p.dirty
+}
+
+// Random tries a few random members before settling for the first available one.
+func Random[T Backend](members []T) (T, error) {
+	var none T
+	amount := len(members)
+	if amount == 0 {
+		return none, errors.New("No configured backends to choose from")
+	}
+
+	for attempts := 1; attempts <= amount; attempts++ {
+		candidate := members[rand.Intn(amount)]
+		if candidate.Available() {
+			return candidate, nil
+		}
+	}
+
+	// If quick selection didn't work out, we'll get the first available that matches
+	for _, candidate := range members {
+		if candidate.Available() {
+			return candidate, nil
+		}
+	}
+
+	return none, errors.New("All backends are either shut down, marked as dirty or have their circuit open")
+}
@@ -0,0 +1,138 @@
+package pool
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type fakeBackend struct {
+	id        string
+	available bool
+	active    int
+}
+
+func (b *fakeBackend) ID() string      { return b.id }
+func (b *fakeBackend) Available() bool { return b.available }
+func (b *fakeBackend) Acquire()        { b.active++ }
+func (b *fakeBackend) Release()        { b.active-- }
+
+func newPool(members ...*fakeBackend) *Pool[*fakeBackend] {
+	p := New[*fakeBackend](&sync.RWMutex{}, 2)
+	p.Set(members)
+	return p
+}
+
+func TestGetAcquiresAndReleases(t *testing.T) {
+	b := &fakeBackend{id: "a", available: true}
+	p := newPool(b)
+
+	got, release, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned error: %s", err)
+	}
+	if got != b {
+		t.Fatalf("Get returned %s, expected a", got.id)
+	}
+	if b.active != 1 {
+		t.Fatalf("expected 1 active request, got %d", b.active)
+	}
+
+	release()
+	release()
+	if b.active != 0 {
+		t.Fatalf("expected release to be idempotent, got %d active requests", b.active)
+	}
+}
+
+func TestGetSkipsUnavailable(t *testing.T) {
+	down := &fakeBackend{id: "down"}
+	up := &fakeBackend{id: "up", available: true}
+	p := newPool(down, up, down)
+
+	for i := 0; i < 20; i++ {
+		got, release, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get returned error: %s", err)
+		}
+		if got != up {
+			t.Fatalf("Get returned unavailable backend %s", got.id)
+		}
+		release()
+	}
+}
+
+func TestGetWithoutAvailableBackends(t *testing.T) {
+	if _, _, err := newPool().Get(); err == nil {
+		t.Fatal("expected an error from an empty pool")
+	}
+	if _, _, err := newPool(&fakeBackend{id: "down"}).Get(); err == nil {
+		t.Fatal("expected an error when no backend is available")
+	}
+}
+
+func TestGetWith(t *testing.T) {
+	a := &fakeBackend{id: "a", available: true}
+	b := &fakeBackend{id: "b", available: true}
+	p := newPool(a, b)
+
+	last := func(members []*fakeBackend) (*fakeBackend, error) {
+		return members[len(members)-1], nil
+	}
+	got, release, err := p.GetWith(last)
+	if err != nil {
+		t.Fatalf("GetWith returned error: %s", err)
+	}
+	if got != b || b.active != 1 || a.active != 0 {
+		t.Fatalf("expected b to be acquired, got %s", got.id)
+	}
+	release()
+
+	failing := func(members []*fakeBackend) (*fakeBackend, error) {
+		return nil, errors.New("no match")
+	}
+	if _, release, err := p.GetWith(failing); err == nil || release != nil {
+		t.Fatal("expected selector error without a release function")
+	}
+	if a.active != 0 || b.active != 0 {
+		t.Fatal("failed selection acquired a backend")
+	}
+}
+
+func TestMarkDirty(t *testing.T) {
+	p := newPool()
+
+	if !p.MarkDirty("a") || !p.MarkDirty("b") {
+		t.Fatal("expected notifications to fit the queue")
+	}
+	if p.MarkDirty("c") {
+		t.Fatal("expected notification to be dropped from a full queue")
+	}
+
+	for _, expected := range []string{"a", "b"} {
+		if id := <-p.Dirty(); id != expected {
+			t.Fatalf("expected dirty %s, got %s", expected, id)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	if _, err := Random[*fakeBackend](nil); err == nil {
+		t.Fatal("expected an error without members")
+	}
+
+	up := &fakeBackend{id: "up", available: true}
+	members := []*fakeBackend{{id: "down"}, {id: "down"}, up}
+	for i := 0; i < 20; i++ {
+		got, err := Random(members)
+		if err != nil {
+			t.Fatalf("Random returned error: %s", err)
+		}
+		if got != up {
+			t.Fatalf("Random returned unavailable backend %s", got.id)
+		}
+	}
+	if up.active != 0 {
+		t.Fatal("Random shouldn't acquire the backend")
+	}
+}
@@ -0,0 +1,133 @@
+package fpm
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const readinessProbeInterval = 250 * time.Millisecond
+const connectivityTimeout = 2 * time.Second
+
+// waitUntilReady dials the container's readiness probe port until it accepts a TCP
+// connection, ReadinessTimeoutSeconds has passed or abort is closed. Probing is skipped when
+// no timeout is set.
+func (s *ReqController) waitUntilReady(c *Container, abort <-chan struct{}) error {
+	if s.Config.ReadinessTimeoutSeconds <= 0 {
+		return nil
+	}
+
+	addr := s.backendAddr(c, s.Config.probePort())
+	deadline := time.Now().Add(time.Duration(s.Config.ReadinessTimeoutSeconds) * time.Second)
+
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return &ReadinessTimeoutError{
+				ContainerID:    c.Id,
+				DeploymentName: s.Config.Deployment,
+				Timeout:        time.Duration(s.Config.ReadinessTimeoutSeconds) * time.Second,
+				OriginalError:  err,
+			}
+		}
+		select {
+		case <-abort:
+			return s.containerError(c.Id, err, "Readiness probe of container %s aborted", c.Name)
+		case <-time.After(readinessProbeInterval):
+		}
+	}
+}
+
+// warmUp runs the configured warm-up commands in the container one by one. A failed
+// warm-up is only reported, as the container is still able to serve requests.
+func (s *ReqController) warmUp(c *Container) {
+	for _, cmd := range s.Config.WarmupCommands {
+		exitCode, err := s.DockerCli.ExecInContainer(context.Background(), c.Id, cmd)
+		if err != nil {
+			s.logger().Warn("container warm-up failed", "deployment", s.Config.Deployment, "name", c.Name, "error", err)
+			return
+		}
+		if exitCode != 0 {
+			s.logger().Warn("container warm-up command failed", "deployment", s.Config.Deployment, "name", c.Name, "command", cmd, "exit_code", exitCode)
+			return
+		}
+	}
+}
+
+// validateConnectivity dials every started container and returns an error listing the ones
+// that can't be reached, instead of letting requests get routed to them.
+func (s *ReqController) validateConnectivity() error {
+	unreachable := []string{}
+	for _, c := range s.pool.Members() {
+		if !c.Started {
+			continue
+		}
+
+		addr := s.backendAddr(c, s.Config.primaryPort())
+		conn, err := net.DialTimeout("tcp", addr, connectivityTimeout)
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s (%s)", c.Name, addr))
+			continue
+		}
+		conn.Close()
+	}
+
+	if len(unreachable) > 0 {
+		return errors.New(fmt.Sprintf("Unable to reach containers: %s", strings.Join(unreachable, ", ")))
+	}
+
+	return nil
+}
+
+// revalidate probes the containers reported dirty and removes the ones that respond from
+// dirty. The probes are done without holding the lock, so that requests keep being served.
+func (s *ReqController) revalidate(dirty map[string]bool) {
+	addrs := map[string]string{}
+	s.Lock.RLock()
+	for _, c := range s.pool.Members() {
+		if dirty[c.Id] && c.Started {
+			addrs[c.Id] = s.backendAddr(c, s.Config.probePort())
+		}
+	}
+	s.Lock.RUnlock()
+
+	for id, addr := range addrs {
+		if s.probeWithBackoff(addr) {
+			s.logger().Info("container recovered, returning it to the pool", "deployment", s.Config.Deployment, "id", docker.ShortID(id))
+			delete(dirty, id)
+		}
+	}
+}
+
+// probeWithBackoff dials addr until it accepts a connection, doubling the wait between
+// attempts. False is returned if DirtyRevalidationAttempts run out or the controller is closed.
+func (s *ReqController) probeWithBackoff(addr string) bool {
+	wait := readinessProbeInterval
+	for attempt := 0; attempt <= s.Config.DirtyRevalidationAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-s.stop:
+				return false
+			case <-time.After(wait):
+			}
+			wait *= 2
+		}
+
+		conn, err := net.DialTimeout("tcp", addr, connectivityTimeout)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+	}
+
+	return false
+}
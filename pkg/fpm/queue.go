@@ -0,0 +1,139 @@
+package fpm
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+const queuePollInterval = 50 * time.Millisecond
+
+var (
+	errQueueTimeout = errors.New("Timed out waiting for an available container")
+	errQueueClosed  = errors.New("Controller was closed while waiting for an available container")
+)
+
+// pendingRequest is handed its result over an unbuffered channel, so a container is never
+// left acquired for a request that stopped waiting: the worker releases it instead if ctx
+// or stop, which end the wait, are done.
+type pendingRequest struct {
+	request  *http.Request
+	ctx      context.Context
+	stop     chan struct{}
+	deadline time.Time
+	result   chan queueResult
+}
+
+type queueResult struct {
+	container *Container
+	addr      string
+	release   func()
+	err       error
+}
+
+// enqueue waits for a container to become available through the request queue. False is
+// returned if the queue is full. The wait ends at the latest when ctx is done or the
+// controller is closed.
+func (s *ReqController) enqueue(ctx context.Context, r *http.Request) (queueResult, bool) {
+	req := &pendingRequest{
+		request:  r,
+		ctx:      ctx,
+		stop:     s.stop,
+		deadline: time.Now().Add(time.Duration(s.Config.QueueTimeoutSeconds) * time.Second),
+		result:   make(chan queueResult),
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(req.deadline) {
+		req.deadline = deadline
+	}
+
+	select {
+	case <-req.stop:
+		return queueResult{err: errQueueClosed}, true
+	default:
+	}
+
+	select {
+	case s.requestQueue <- req:
+		queueDepth.WithLabelValues(s.Config.Deployment).Set(float64(len(s.requestQueue)))
+	default:
+		return queueResult{}, false
+	}
+
+	select {
+	case res := <-req.result:
+		return res, true
+	case <-ctx.Done():
+		return queueResult{err: ctx.Err()}, true
+	case <-req.stop:
+		return queueResult{err: errQueueClosed}, true
+	}
+}
+
+// queueWorker hands available containers to queued requests until the controller is closed.
+// The requests still queued then are failed.
+func (s *ReqController) queueWorker() {
+	defer s.background.Done()
+	stop := s.stop
+
+	for {
+		select {
+		case <-stop:
+			s.drainQueue()
+			return
+		case req := <-s.requestQueue:
+			queueDepth.WithLabelValues(s.Config.Deployment).Set(float64(len(s.requestQueue)))
+			s.respond(req, s.waitForContainer(req))
+		}
+	}
+}
+
+// respond hands the result to the request, or releases the container if the request is no
+// longer waiting for it.
+func (s *ReqController) respond(req *pendingRequest, res queueResult) {
+	select {
+	case req.result <- res:
+	case <-req.ctx.Done():
+		if res.release != nil {
+			res.release()
+		}
+	case <-req.stop:
+		if res.release != nil {
+			res.release()
+		}
+	}
+}
+
+func (s *ReqController) drainQueue() {
+	for {
+		select {
+		case req := <-s.requestQueue:
+			s.respond(req, queueResult{err: errQueueClosed})
+		default:
+			queueDepth.WithLabelValues(s.Config.Deployment).Set(0)
+			return
+		}
+	}
+}
+
+func (s *ReqController) waitForContainer(req *pendingRequest) queueResult {
+	r, deadline := req.request, req.deadline
+	for {
+		chosen, addr, release, err := s.acquireContainer(r)
+		if err == nil {
+			return queueResult{container: chosen, addr: addr, release: release}
+		}
+
+		if time.Now().After(deadline) {
+			return queueResult{err: errQueueTimeout}
+		}
+
+		select {
+		case <-req.stop:
+			return queueResult{err: errQueueClosed}
+		case <-req.ctx.Done():
+			return queueResult{err: req.ctx.Err()}
+		case <-time.After(queuePollInterval):
+		}
+	}
+}
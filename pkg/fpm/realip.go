@@ -0,0 +1,69 @@
+package fpm
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIPHeader carries the client address found through trusted proxies to the containers.
+const RealIPHeader = "X-Real-IP"
+
+func parseTrustedProxies(conf ControllerConfig) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, cidr := range conf.TrustedProxyCIDRs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, configError(conf, "Invalid trusted proxy CIDR %s: %s", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+func (s *ReqController) trustedProxy(ip net.IP) bool {
+	for _, n := range s.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withRealIP replaces the remote address of a request from a trusted proxy with the client
+// address in X-Forwarded-For, like the real_ip module of nginx. The list is read from the
+// right, skipping trusted proxies, as the left end can be forged by the client.
+func (s *ReqController) withRealIP(r *http.Request) *http.Request {
+	host, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !s.trustedProxy(ip) {
+		// Only trusted proxies get to tell the client address.
+		r.Header.Del(RealIPHeader)
+		return r
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		if i > 0 && s.trustedProxy(ip) {
+			continue
+		}
+
+		rewritten := r.Clone(r.Context())
+		rewritten.RemoteAddr = net.JoinHostPort(ip.String(), port)
+		if port == "" {
+			rewritten.RemoteAddr = ip.String()
+		}
+		rewritten.Header.Set(RealIPHeader, ip.String())
+		return rewritten
+	}
+
+	return r
+}
@@ -0,0 +1,262 @@
+package fpm
+
+import (
+	stderrors "errors"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Server routes requests to multiple controllers by Host header or path prefix. It
+// implements http.Handler, so it can be embedded to an existing HTTP server or served
+// over FastCGI:
+//
+//	srv := fpm.NewServer()
+//	srv.AddHost("app.example.com", &app)
+//	srv.AddPrefix("/legacy/", &legacy)
+//	if err := srv.Init(); err != nil {
+//		return err
+//	}
+//	defer srv.Close()
+//	fcgi.Serve(l, srv)
+//
+// Host routes are matched first, then the longest matching path prefix.
+type Server struct {
+	Lock     *sync.RWMutex
+	config   ServerConfig
+	hosts    map[string]*ReqController
+	prefixes []prefixRoute
+	limiter  *rate.Limiter
+}
+
+type prefixRoute struct {
+	prefix     string
+	controller *ReqController
+}
+
+// NewServer creates a server with DefaultServerConfig.
+func NewServer() *Server {
+	return NewServerWithConfig(DefaultServerConfig())
+}
+
+// NewServerWithConfig creates a server with the given configuration.
+func NewServerWithConfig(config ServerConfig) *Server {
+	srv := &Server{
+		Lock:   &sync.RWMutex{},
+		config: config,
+		hosts:  map[string]*ReqController{},
+	}
+	if config.GlobalDockerCallsPerSecond > 0 {
+		srv.limiter = rate.NewLimiter(rate.Limit(config.GlobalDockerCallsPerSecond), config.GlobalDockerCallsPerSecond)
+	}
+
+	return srv
+}
+
+// AddHost routes requests with the given Host header (port excluded) to the controller.
+func (s *Server) AddHost(host string, c *ReqController) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	s.hosts[strings.ToLower(host)] = c
+}
+
+// AddPrefix routes requests with a path starting with prefix to the controller.
+func (s *Server) AddPrefix(prefix string, c *ReqController) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	s.prefixes = append(s.prefixes, prefixRoute{prefix: prefix, controller: c})
+	sort.SliceStable(s.prefixes, func(i, j int) bool {
+		return len(s.prefixes[i].prefix) > len(s.prefixes[j].prefix)
+	})
+}
+
+// controllers returns every routed controller once.
+func (s *Server) controllers() []*ReqController {
+	seen := map[*ReqController]bool{}
+	all := []*ReqController{}
+	add := func(c *ReqController) {
+		if !seen[c] {
+			seen[c] = true
+			all = append(all, c)
+		}
+	}
+
+	for _, c := range s.hosts {
+		add(c)
+	}
+	for _, route := range s.prefixes {
+		add(route.controller)
+	}
+
+	return all
+}
+
+// Init initializes all routed controllers in the order given by their DependsOn settings.
+// Deployments that don't depend on each other are initialized in parallel.
+func (s *Server) Init() error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	groups, err := startupOrder(s.controllers())
+	if err != nil {
+		return err
+	}
+
+	for _, c := range s.controllers() {
+		c.setConnectionPoolSize(s.config.BackendIdleConnsPerContainer)
+	}
+
+	if s.limiter != nil {
+		for _, c := range s.controllers() {
+			if err := c.DockerCli.SetLimiter(s.limiter); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, group := range groups {
+		var wg sync.WaitGroup
+		errs := make([]error, len(group))
+		for i, c := range group {
+			wg.Add(1)
+			go func(i int, c *ReqController) {
+				defer wg.Done()
+				if err := c.Init(); err != nil {
+					errs[i] = c.deploymentError(err, "Unable to initialize deployment %s", c.Config.Deployment)
+				}
+			}(i, c)
+		}
+		wg.Wait()
+
+		if err := stderrors.Join(errs...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Serve initializes the deployments and serves them over FastCGI on the listener.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.Init(); err != nil {
+		return err
+	}
+
+	return fcgi.Serve(newLimitListener(l, s.config.MaxConcurrentFCGIConnections, s.config.acceptTimeout()), s)
+}
+
+// startupOrder sorts the controllers topologically by their dependencies into groups, where
+// every group only depends on the ones before it.
+func startupOrder(controllers []*ReqController) ([][]*ReqController, error) {
+	byName := map[string]*ReqController{}
+	for _, c := range controllers {
+		byName[c.Config.Deployment] = c
+	}
+
+	pending := map[string]int{}
+	dependents := map[string][]string{}
+	for _, c := range controllers {
+		name := c.Config.Deployment
+		pending[name] = len(c.Config.DependsOn)
+		for _, dep := range c.Config.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, errors.New(fmt.Sprintf("Deployment %s depends on unknown deployment %s", name, dep))
+			}
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	groups := [][]*ReqController{}
+	ready := []string{}
+	for name, count := range pending {
+		if count == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	done := 0
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		group := []*ReqController{}
+		next := []string{}
+		for _, name := range ready {
+			group = append(group, byName[name])
+			for _, dependent := range dependents[name] {
+				pending[dependent]--
+				if pending[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		groups = append(groups, group)
+		done += len(group)
+		ready = next
+	}
+
+	if done < len(byName) {
+		cyclic := []string{}
+		for name, count := range pending {
+			if count > 0 {
+				cyclic = append(cyclic, name)
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, errors.New(fmt.Sprintf("Dependency cycle between deployments %s", strings.Join(cyclic, ", ")))
+	}
+
+	return groups, nil
+}
+
+// Close shuts down all routed controllers, returning every error encountered joined together.
+func (s *Server) Close() error {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	errs := []error{}
+	for _, c := range s.controllers() {
+		if err := c.Close(); err != nil {
+			errs = append(errs, c.deploymentError(err, "Unable to close deployment %s", c.Config.Deployment))
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+func (s *Server) route(r *http.Request) *ReqController {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if c, ok := s.hosts[strings.ToLower(host)]; ok {
+		return c
+	}
+
+	for _, route := range s.prefixes {
+		if strings.HasPrefix(r.URL.Path, route.prefix) {
+			return route.controller
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := s.route(r)
+	if c == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	c.ServeHTTP(w, r)
+}
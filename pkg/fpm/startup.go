@@ -0,0 +1,63 @@
+package fpm
+
+import (
+	"sync"
+	"time"
+)
+
+// startupState coordinates starting the containers of a dynamic deployment, so that only
+// one request at a time tries it while others wait for the outcome.
+type startupState struct {
+	cond        *sync.Cond
+	starting    bool
+	lastAttempt time.Time
+	lastErr     error
+}
+
+func newStartupState() *startupState {
+	return &startupState{cond: sync.NewCond(&sync.Mutex{})}
+}
+
+func (s *ReqController) containersStarted() bool {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	return s.pool.Len() == 0 || s.pool.Members()[0].Started
+}
+
+// ensureStarted starts the containers of a dynamic deployment if they've been shut down.
+// Requests arriving during a start wait for it instead of queueing for the write lock, and
+// after a failed start, requests within StartupBackoffMs get the same error without retrying.
+func (s *ReqController) ensureStarted() error {
+	st := s.startup
+	st.cond.L.Lock()
+	defer st.cond.L.Unlock()
+
+	for st.starting {
+		st.cond.Wait()
+	}
+
+	if s.containersStarted() {
+		return nil
+	}
+
+	backoff := time.Duration(s.Config.StartupBackoffMs) * time.Millisecond
+	if st.lastErr != nil && time.Since(st.lastAttempt) < backoff {
+		return st.lastErr
+	}
+
+	st.starting = true
+	st.cond.L.Unlock()
+
+	s.Lock.Lock()
+	err := s.startContainers()
+	s.Lock.Unlock()
+
+	st.cond.L.Lock()
+	st.starting = false
+	st.lastAttempt = time.Now()
+	st.lastErr = err
+	st.cond.Broadcast()
+
+	return err
+}
@@ -0,0 +1,95 @@
+package fpm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type Stats struct {
+	Deployment     string
+	Paused         bool
+	Containers     int
+	Started        int
+	Dirty          int
+	ContainerStats []ContainerStats
+}
+
+type ContainerStats struct {
+	Name        string
+	Id          string
+	Started     bool
+	Dirty       bool
+	Paused      bool
+	CircuitOpen bool
+	ActiveReqs  int64
+	CreatedAt   time.Time
+	StartedAt   time.Time
+	OOMKills    int64
+	Restarts    int
+	LatencyP50  time.Duration
+	LatencyP95  time.Duration
+	LatencyP99  time.Duration
+}
+
+func (s *ReqController) Stats() Stats {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	stats := Stats{
+		Deployment:     s.Config.Deployment,
+		Paused:         s.IsPaused(),
+		Containers:     s.pool.Len(),
+		ContainerStats: []ContainerStats{},
+	}
+
+	for _, c := range s.pool.Members() {
+		if c.Started {
+			stats.Started++
+		}
+		if c.Dirty {
+			stats.Dirty++
+		}
+
+		stats.ContainerStats = append(stats.ContainerStats, ContainerStats{
+			Name:        c.Name,
+			Id:          c.Id,
+			Started:     c.Started,
+			Dirty:       c.Dirty,
+			Paused:      c.Paused,
+			CircuitOpen: c.CircuitOpen(),
+			ActiveReqs:  atomic.LoadInt64(&c.ActiveReqs),
+			CreatedAt:   c.CreatedAt,
+			StartedAt:   c.StartedAt,
+			OOMKills:    atomic.LoadInt64(&c.OOMKillCount),
+			Restarts:    c.RestartCount,
+			LatencyP50:  c.LatencyHistogram.Percentile(50),
+			LatencyP95:  c.LatencyHistogram.Percentile(95),
+			LatencyP99:  c.LatencyHistogram.Percentile(99),
+		})
+	}
+
+	return stats
+}
+
+// HealthRatio returns the share of the deployment's containers that are started and not dirty.
+func (s *ReqController) HealthRatio() float64 {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	return s.healthRatio()
+}
+
+func (s *ReqController) healthRatio() float64 {
+	if s.pool.Len() == 0 {
+		return 0
+	}
+
+	healthy := 0
+	for _, c := range s.pool.Members() {
+		if c.Started && !c.Dirty {
+			healthy++
+		}
+	}
+
+	return float64(healthy) / float64(s.pool.Len())
+}
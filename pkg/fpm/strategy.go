@@ -0,0 +1,100 @@
+package fpm
+
+import (
+	"github.com/ajmyyra/docker-fpm/pkg/fpm/pool"
+	"github.com/pkg/errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// SelectionStrategy chooses the container a request is proxied to. Select is called with the
+// read lock held and may only pick among the given containers, skipping the ones that aren't
+// Available. Implementations have to be safe for concurrent use.
+type SelectionStrategy interface {
+	Select(containers []*Container, r *http.Request) (*Container, error)
+}
+
+// RandomStrategy picks a random available container. It's used when no strategy is configured.
+type RandomStrategy struct{}
+
+func (RandomStrategy) Select(containers []*Container, r *http.Request) (*Container, error) {
+	return pool.Random(containers)
+}
+
+// RoundRobinStrategy cycles through the available containers. It has to be used as a pointer,
+// e.g. &fpm.RoundRobinStrategy{}.
+type RoundRobinStrategy struct {
+	next uint64
+}
+
+func (rr *RoundRobinStrategy) Select(containers []*Container, r *http.Request) (*Container, error) {
+	amount := len(containers)
+	if amount == 0 {
+		return nil, errors.New("No configured containers to choose from")
+	}
+
+	start := int(atomic.AddUint64(&rr.next, 1) % uint64(amount))
+	for i := 0; i < amount; i++ {
+		if candidate := containers[(start+i)%amount]; candidate.Available() {
+			return candidate, nil
+		}
+	}
+
+	return nil, errors.New("All containers are either shut down, marked as dirty or have their circuit open")
+}
+
+// LeastConnectionsStrategy picks the available container with the fewest active requests.
+type LeastConnectionsStrategy struct{}
+
+func (LeastConnectionsStrategy) Select(containers []*Container, r *http.Request) (*Container, error) {
+	if len(containers) == 0 {
+		return nil, errors.New("No configured containers to choose from")
+	}
+
+	var chosen *Container
+	var least int64
+	for _, candidate := range containers {
+		if !candidate.Available() {
+			continue
+		}
+		if active := atomic.LoadInt64(&candidate.ActiveReqs); chosen == nil || active < least {
+			chosen, least = candidate, active
+		}
+	}
+	if chosen == nil {
+		return nil, errors.New("All containers are either shut down, marked as dirty or have their circuit open")
+	}
+
+	return chosen, nil
+}
+
+// selectionStrategy returns the configured strategy. HashHeader is a shorthand for
+// HashHeaderStrategy.
+func (c ControllerConfig) selectionStrategy() SelectionStrategy {
+	if c.Strategy != nil {
+		return c.Strategy
+	}
+	if c.HashHeader != "" {
+		return HashHeaderStrategy{Header: c.HashHeader}
+	}
+
+	return RandomStrategy{}
+}
+
+// strategyName is used as the strategy label of the selection latency metric.
+func strategyName(strategy SelectionStrategy) string {
+	switch strategy.(type) {
+	case RandomStrategy:
+		return "random"
+	case *RoundRobinStrategy:
+		return "round_robin"
+	case LeastConnectionsStrategy:
+		return "least_connections"
+	case StickyIPStrategy:
+		return "sticky_ip"
+	case HashHeaderStrategy:
+		return "hash"
+	default:
+		return "custom"
+	}
+}
@@ -0,0 +1,69 @@
+package fpm
+
+import (
+	"context"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"strings"
+)
+
+// phpWorkerCommand is the process title PHP-FPM gives to its worker processes.
+const phpWorkerCommand = "php-fpm: pool"
+
+// StuckProcess is a PHP-FPM worker that has been running for too long.
+type StuckProcess struct {
+	ContainerID   string
+	ContainerName string
+	Process       docker.ProcessInfo
+}
+
+// DetectStuckProcesses returns the PHP-FPM workers of started containers that have been
+// running for more than maxAgeSeconds. Worker age only tells about stuck requests when
+// workers are recycled after each request, e.g. with pm = ondemand or pm.max_requests = 1.
+func (s *ReqController) DetectStuckProcesses(maxAgeSeconds int) ([]StuckProcess, error) {
+	s.Lock.RLock()
+	started := []*Container{}
+	for _, c := range s.pool.Members() {
+		if c.Started {
+			started = append(started, c)
+		}
+	}
+	s.Lock.RUnlock()
+
+	stuck := []StuckProcess{}
+	for _, c := range started {
+		processes, err := s.DockerCli.ContainerTopProcesses(context.Background(), c.Id)
+		if err != nil {
+			return nil, s.deploymentError(err, "Unable to inspect processes of deployment %s", s.Config.Deployment)
+		}
+
+		for _, p := range processes {
+			if strings.HasPrefix(p.Command, phpWorkerCommand) && p.ElapsedSeconds > maxAgeSeconds {
+				stuck = append(stuck, StuckProcess{ContainerID: c.Id, ContainerName: c.Name, Process: p})
+			}
+		}
+	}
+
+	return stuck, nil
+}
+
+// restartStuckContainers recreates containers with stuck workers. They're recreated directly
+// instead of being marked dirty, as revalidation would find them still accepting connections.
+func (s *ReqController) restartStuckContainers() {
+	stuck, err := s.DetectStuckProcesses(s.Config.StuckProcessMaxAgeSeconds)
+	if err != nil {
+		s.logger().Error("unable to detect stuck processes", "deployment", s.Config.Deployment, "error", err)
+		return
+	}
+
+	reported := map[string]bool{}
+	for _, p := range stuck {
+		if reported[p.ContainerID] {
+			continue
+		}
+		reported[p.ContainerID] = true
+		s.logger().Warn("worker is stuck, recreating the container", "deployment", s.Config.Deployment, "name", p.ContainerName, "pid", p.Process.PID, "elapsed_seconds", p.Process.ElapsedSeconds)
+		if err := s.ForceRecreateContainer(p.ContainerID); err != nil {
+			s.logger().Error("unable to recreate container with stuck workers", "deployment", s.Config.Deployment, "name", p.ContainerName, "error", err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package fpm
+
+import (
+	"context"
+	"net"
+)
+
+// validateSubnet checks that the configured subnet is valid CIDR and contains the gateway.
+func validateSubnet(conf ControllerConfig) error {
+	if conf.NetworkName == "" {
+		return configError(conf, "NetworkSubnet and NetworkGateway require a deployment network")
+	}
+	if !conf.CreateNetworkIfMissing {
+		return configError(conf, "NetworkSubnet and NetworkGateway only apply to networks created with CreateNetworkIfMissing")
+	}
+	if conf.NetworkSubnet == "" {
+		return configError(conf, "NetworkGateway requires NetworkSubnet to be set")
+	}
+
+	_, subnet, err := net.ParseCIDR(conf.NetworkSubnet)
+	if err != nil {
+		return configError(conf, "Invalid NetworkSubnet %s: %s", conf.NetworkSubnet, err)
+	}
+
+	if conf.NetworkGateway != "" {
+		gw := net.ParseIP(conf.NetworkGateway)
+		if gw == nil {
+			return configError(conf, "Invalid NetworkGateway %s", conf.NetworkGateway)
+		}
+		if !subnet.Contains(gw) {
+			return configError(conf, "NetworkGateway %s is outside of NetworkSubnet %s", conf.NetworkGateway, conf.NetworkSubnet)
+		}
+	}
+
+	return nil
+}
+
+// checkSubnetOverlap makes sure the configured subnet doesn't overlap with networks of
+// other docker-fpm deployments.
+func (s *ReqController) checkSubnetOverlap() error {
+	_, own, err := net.ParseCIDR(s.Config.NetworkSubnet)
+	if err != nil {
+		return configError(s.Config, "Invalid NetworkSubnet %s: %s", s.Config.NetworkSubnet, err)
+	}
+
+	subnets, err := s.DockerCli.DeploymentSubnets(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for cidr, deployment := range subnets {
+		_, other, err := net.ParseCIDR(cidr)
+		if err != nil || deployment == s.Config.Deployment {
+			continue
+		}
+		// CIDR ranges either nest or are disjoint, so checking both base addresses is enough.
+		if own.Contains(other.IP) || other.Contains(own.IP) {
+			return configError(s.Config, "NetworkSubnet %s overlaps with subnet %s of deployment %s", s.Config.NetworkSubnet, cidr, deployment)
+		}
+	}
+
+	return nil
+}
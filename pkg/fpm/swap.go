@@ -0,0 +1,76 @@
+package fpm
+
+import (
+	"github.com/ajmyyra/docker-fpm/pkg/fpm/pool"
+)
+
+// Swap replaces the deployment's containers with ones created from conf. The current
+// configuration is kept, so that if the swap fails, Rollback can be called with it to return
+// to the previous state. Docker client settings (retries, logger) are not changed.
+func (s *ReqController) Swap(conf ControllerConfig) error {
+	previous := s.Config
+	s.previousConfig = &previous
+
+	if err := s.reinitialize(conf); err != nil {
+		return s.deploymentError(err, "Unable to swap deployment %s", s.Config.Deployment)
+	}
+
+	return nil
+}
+
+// Rollback removes the current containers and initializes the deployment again from
+// previousConfig, e.g. the one returned by PreviousConfig after a failed Swap.
+func (s *ReqController) Rollback(previousConfig ControllerConfig) error {
+	if err := s.reinitialize(previousConfig); err != nil {
+		return s.deploymentError(err, "Unable to roll back deployment %s", s.Config.Deployment)
+	}
+	s.previousConfig = nil
+
+	return nil
+}
+
+// PreviousConfig returns the configuration in use before the last Swap, or nil if there
+// is nothing to roll back to.
+func (s *ReqController) PreviousConfig() *ControllerConfig {
+	return s.previousConfig
+}
+
+// reinitialize tears down the current deployment and initializes it again with conf. The
+// configuration and image are checked before the current containers are removed, but the
+// new containers can still fail to start, leaving the deployment to be rolled back.
+func (s *ReqController) reinitialize(conf ControllerConfig) error {
+	// Building a throwaway controller validates the configuration and sets up what depends on it.
+	next, err := NewReqController(conf)
+	if err != nil {
+		return err
+	}
+	defer next.DockerCli.Close()
+
+	if conf.AutoPull {
+		if err := next.pullImage(); err != nil {
+			return err
+		}
+	}
+	if err := next.checkImage(); err != nil {
+		return err
+	}
+
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	s.Lock.Lock()
+	s.Config = next.Config
+	s.HttpCli = next.HttpCli
+	s.pool = pool.New[*Container](s.Lock, conf.ContainerAmount)
+	s.syncContainers()
+	s.requestQueue = next.requestQueue
+	s.webhook = next.webhook
+	s.trustedProxies = next.trustedProxies
+	s.dedup = next.dedup
+	s.failover = next.failover
+	s.pinnedImage = ""
+	s.Lock.Unlock()
+
+	return s.Init()
+}
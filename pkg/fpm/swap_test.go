@@ -0,0 +1,109 @@
+package fpm
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSwapFailureAndRollback(t *testing.T) {
+	daemon := newFakeDocker(t)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer backend.Close()
+	// Nothing listens on the port of the closed server, so containers using it never get ready.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	conf := DefaultConfig("test", "php", "fpm", backendPort(t, backend))
+	conf.Type = StaticController
+	conf.ReadinessTimeoutSeconds = 1
+
+	s, err := NewReqController(conf)
+	if err != nil {
+		t.Fatalf("unable to create controller: %s", err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("unable to initialize controller: %s", err)
+	}
+	defer s.Close()
+
+	broken := conf
+	broken.ContainerPort = backendPort(t, closed)
+	broken.ContainerPorts = []int{broken.ContainerPort}
+
+	err = s.Swap(broken)
+	var timeoutErr *ReadinessTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("expected the swap to fail with a readiness timeout, got %v", err)
+	}
+	if s.PreviousConfig() == nil || s.PreviousConfig().ContainerPort != conf.ContainerPort {
+		t.Fatal("expected the previous configuration to be kept after a failed swap")
+	}
+
+	if err := s.Rollback(*s.PreviousConfig()); err != nil {
+		t.Fatalf("rollback failed: %s", err)
+	}
+	if s.PreviousConfig() != nil {
+		t.Error("expected the previous configuration to be cleared by the rollback")
+	}
+	if s.Config.ContainerPort != conf.ContainerPort {
+		t.Errorf("expected port %d after rollback, got %d", conf.ContainerPort, s.Config.ContainerPort)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("expected the request to reach the backend after rollback, got status %d", w.Code)
+	}
+	if running := daemon.running(); running != conf.ContainerAmount {
+		t.Errorf("expected %d running containers after rollback, got %d", conf.ContainerAmount, running)
+	}
+}
+
+func TestSwapFailoverType(t *testing.T) {
+	daemon := newFakeDocker(t)
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	conf := DefaultConfig("test", "php", "fpm", backendPort(t, backend))
+	conf.Type = StaticController
+	conf.ContainerAmount = 1
+
+	s, err := NewReqController(conf)
+	if err != nil {
+		t.Fatalf("unable to create controller: %s", err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatalf("unable to initialize controller: %s", err)
+	}
+	defer s.Close()
+
+	failover := conf
+	failover.Type = FailoverController
+	failover.FallbackImage = "maintenance"
+	if err := s.Swap(failover); err != nil {
+		t.Fatalf("swap to a failover deployment failed: %s", err)
+	}
+	if s.failover == nil {
+		t.Fatal("expected the failover deployment to have a fallback pool")
+	}
+	if _, err := s.fallbackController(); err != nil {
+		t.Fatalf("unable to start the fallback pool: %s", err)
+	}
+	if running := daemon.running(); running != 2 {
+		t.Fatalf("expected the container and the fallback container to run, got %d", running)
+	}
+
+	if err := s.Swap(conf); err != nil {
+		t.Fatalf("swap to a static deployment failed: %s", err)
+	}
+	if s.failover != nil {
+		t.Error("expected the static deployment to have no fallback pool")
+	}
+	if running := daemon.running(); running != 1 {
+		t.Errorf("expected the fallback pool to be closed by the swap, got %d running containers", running)
+	}
+}
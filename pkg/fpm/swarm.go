@@ -0,0 +1,89 @@
+package fpm
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const ContainerBackend = "container"
+const SwarmServiceBackend = "swarm-service"
+
+const serviceEndpointPollInterval = 250 * time.Millisecond
+
+func (c ControllerConfig) swarmMode() bool {
+	return c.BackendMode == SwarmServiceBackend
+}
+
+// initService creates the deployment's swarm service. The service is represented by a
+// single entry in Containers, routed to through the service VIP when the service is
+// attached to NetworkName, and through the published ingress port otherwise. Swarm takes
+// care of the health of individual tasks.
+func (s *ReqController) initService() error {
+	name, err := s.containerName(1)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.DockerCli.CreateService(context.Background(), docker.ServiceOptions{
+		Name:       name,
+		Image:      s.createImageName(s.Config),
+		Deployment: s.Config.Deployment,
+		Labels:     s.Config.ExtraLabels,
+		Replicas:   s.Config.ContainerAmount,
+		Network:    s.Config.NetworkName,
+		Port:       s.Config.primaryPort(),
+		Auth:       s.Config.RegistryAuth,
+	})
+	if err != nil {
+		return err
+	}
+
+	svc := &Container{
+		Name:      name,
+		Id:        id,
+		HostPorts: map[int]int{},
+	}
+
+	deadline := time.Now().Add(containerWaitTimeout)
+	for {
+		endpoint, err := s.DockerCli.ServiceEndpoint(context.Background(), id, s.Config.NetworkName, s.Config.primaryPort())
+		if err != nil {
+			return err
+		}
+
+		if s.Config.NetworkName != "" && endpoint.VIP != "" {
+			svc.IPAddr = endpoint.VIP
+			break
+		}
+		if s.Config.NetworkName == "" && endpoint.PublishedPort != 0 {
+			svc.HostPorts[s.Config.primaryPort()] = endpoint.PublishedPort
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New(fmt.Sprintf("No endpoint was allocated for service %s of deployment %s", name, s.Config.Deployment))
+		}
+		time.Sleep(serviceEndpointPollInterval)
+	}
+
+	svc.Started = true
+	svc.StartedAt = time.Now()
+	s.pool.Set([]*Container{svc})
+	s.syncContainers()
+
+	return nil
+}
+
+// removeService removes the deployment's swarm service.
+func (s *ReqController) removeService() error {
+	for _, svc := range s.pool.Members() {
+		if err := s.DockerCli.RemoveService(context.Background(), svc.Id); err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,439 @@
+package fpm
+
+import (
+	"context"
+	"fmt"
+	"github.com/ajmyyra/docker-fpm/pkg/docker"
+	"github.com/ajmyyra/docker-fpm/pkg/webhook"
+	"github.com/pkg/errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// healthSync periodically syncs container states from Docker until the controller is closed.
+func (s *ReqController) healthSync(interval time.Duration) {
+	defer s.background.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			err := s.syncContainerStates()
+			if err != nil && docker.IsConnectionFailed(err) && s.Config.DockerReconnectMaxAttempts > 0 {
+				err = s.reconnect()
+			}
+			if err != nil {
+				s.logger().Error("unable to sync container states", "deployment", s.Config.Deployment, "error", err)
+			}
+			if s.Config.WarnContainerAgeMinutes > 0 {
+				s.warnOldContainers()
+			}
+			if s.Config.AuditFilesystemOnSync {
+				s.auditFilesystems()
+			}
+			if s.Config.NetworkStatsOnSync {
+				s.updateNetworkStats()
+			}
+			if s.Config.StuckProcessMaxAgeSeconds > 0 {
+				s.restartStuckContainers()
+			}
+			if s.Config.MaxRestartCount > 0 {
+				s.checkRestartCounts()
+			}
+		}
+	}
+}
+
+// reconnect waits for the Docker daemon to come back and reconciles the containers with it,
+// as they may have been stopped or removed while the daemon was down.
+func (s *ReqController) reconnect() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.DockerCli.Reconnect(ctx); err != nil {
+		return err
+	}
+
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	return s.reconcile()
+}
+
+// auditFilesystems logs the filesystem changes of every started container that weren't
+// there on the previous sync. Changes are expected from sessions and temporary files, so
+// they're logged at debug level.
+func (s *ReqController) auditFilesystems() {
+	s.Lock.RLock()
+	started := []*Container{}
+	for _, c := range s.pool.Members() {
+		if c.Started {
+			started = append(started, c)
+		}
+	}
+	s.Lock.RUnlock()
+
+	for _, c := range started {
+		changes, err := s.AuditContainerFilesystem(c.Id)
+		if err != nil {
+			s.logger().Error("unable to audit container filesystem", "deployment", s.Config.Deployment, "name", c.Name, "error", err)
+			continue
+		}
+		seen := make(map[string]string, len(changes))
+		for _, change := range changes {
+			seen[change.Path] = change.Kind
+			if c.auditedChanges[change.Path] != change.Kind {
+				s.logger().Debug("container filesystem changed", "deployment", s.Config.Deployment, "name", c.Name, "kind", change.Kind, "path", change.Path)
+			}
+		}
+		c.auditedChanges = seen
+	}
+}
+
+// updateNetworkStats fetches the traffic counters of the started containers in parallel, as
+// Docker takes a moment to sample them.
+func (s *ReqController) updateNetworkStats() {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, c := range s.pool.Members() {
+		if !c.Started {
+			continue
+		}
+
+		wg.Add(1)
+		go func(c *Container) {
+			defer wg.Done()
+			rx, tx, err := s.DockerCli.ContainerNetworkStats(context.Background(), c.Id)
+			if err != nil {
+				s.logger().Warn("unable to fetch network stats", "deployment", s.Config.Deployment, "name", c.Name, "error", err)
+				return
+			}
+			atomic.StoreUint64(&c.NetRxBytes, rx)
+			atomic.StoreUint64(&c.NetTxBytes, tx)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// checkRestartCounts updates the restart counts of the started containers and recreates the
+// ones over MaxRestartCount. They're recreated directly instead of being marked dirty, as a
+// crash-looping container may well pass the revalidation probe.
+func (s *ReqController) checkRestartCounts() {
+	s.Lock.RLock()
+	counts := map[*Container]int{}
+	for _, c := range s.pool.Members() {
+		if !c.Started {
+			continue
+		}
+
+		count, err := s.DockerCli.ContainerRestartCount(context.Background(), c.Id)
+		if err != nil {
+			s.logger().Warn("unable to fetch restart count", "deployment", s.Config.Deployment, "name", c.Name, "error", err)
+			continue
+		}
+		counts[c] = count
+	}
+	s.Lock.RUnlock()
+
+	crashLooping := []*Container{}
+	s.Lock.Lock()
+	for c, count := range counts {
+		c.RestartCount = count
+		if count > s.Config.MaxRestartCount && !c.Dirty {
+			crashLooping = append(crashLooping, c)
+		}
+	}
+	s.Lock.Unlock()
+
+	for _, c := range crashLooping {
+		s.logger().Error("container restarted too many times, recreating it", "deployment", s.Config.Deployment, "name", c.Name, "id", docker.ShortID(c.Id), "restarts", c.RestartCount, "limit", s.Config.MaxRestartCount)
+		if err := s.ForceRecreateContainer(c.Id); err != nil {
+			s.logger().Error("unable to recreate crash-looping container", "deployment", s.Config.Deployment, "name", c.Name, "error", err)
+		}
+	}
+}
+
+// warnOldContainers logs a warning for every started container older than WarnContainerAgeMinutes.
+func (s *ReqController) warnOldContainers() {
+	s.Lock.RLock()
+	defer s.Lock.RUnlock()
+
+	limit := time.Duration(s.Config.WarnContainerAgeMinutes) * time.Minute
+	for _, c := range s.pool.Members() {
+		if !c.Started {
+			continue
+		}
+		if age := c.age(); age > limit {
+			s.logger().Warn("container is older than the limit", "deployment", s.Config.Deployment, "name", c.Name, "id", docker.ShortID(c.Id), "age", age.Round(time.Second), "created", c.CreatedAt.Format(time.RFC3339), "limit", limit)
+		}
+	}
+}
+
+// syncContainerStates syncs container states from Docker under the write lock.
+func (s *ReqController) syncContainerStates() error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	return s.syncStates()
+}
+
+// syncStates compares container states to what Docker reports. Containers that have been
+// stopped or removed outside of docker-fpm (e.g. OOM-killed) are marked dirty and recreated.
+func (s *ReqController) syncStates() error {
+	// Swarm keeps the tasks of the service running by itself.
+	if s.Config.swarmMode() {
+		return nil
+	}
+
+	for i, c := range s.pool.Members() {
+		running, gone := false, false
+		details, err := s.DockerCli.ContainerDetails(c.Id)
+		if err != nil {
+			if !docker.IsNotFound(err) {
+				return err
+			}
+			gone = true
+		} else {
+			running = details.State != nil && details.State.Running
+		}
+
+		if gone || (c.Started && !running) {
+			s.logger().Error("container is no longer running, recreating it", "deployment", s.Config.Deployment, "name", c.Name)
+			c.Started = false
+			c.IPAddr = ""
+			c.Dirty = true
+			s.notify(webhook.ContainerDirty, c)
+		} else if running && !s.Config.UseContainerAlias {
+			c.IPAddr = s.containerIP(details)
+		}
+
+		s.pool.Replace(i, c)
+		s.syncContainers()
+	}
+	s.pauseIfTooDirty()
+
+	return s.recreateDirtyContainers()
+}
+
+// Reconcile brings the deployment to its configured state: containers are synced from
+// Docker, broken ones recreated and missing ones created (and started in static mode).
+func (s *ReqController) Reconcile() error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	return s.reconcile()
+}
+
+func (s *ReqController) reconcile() error {
+	return s.reconcileTo(s.Config.ContainerAmount)
+}
+
+func (s *ReqController) reconcileTo(amount int) error {
+	if s.Config.swarmMode() {
+		return nil
+	}
+
+	if err := s.syncStates(); err != nil {
+		return err
+	}
+
+	for s.pool.Len() < amount {
+		if err := s.createNewContainer(); err != nil {
+			return err
+		}
+	}
+
+	if s.Config.startsImmediately() {
+		return s.startContainers()
+	}
+
+	return nil
+}
+
+// cleanupDirty recreates containers reported dirty to the pool until the controller is
+// closed. Notifications arriving together are deduplicated, so that a burst of failing
+// requests to the same container only recreates it once.
+func (s *ReqController) cleanupDirty() {
+	defer s.background.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case id := <-s.pool.Dirty():
+			dirty := map[string]bool{id: true}
+			for pending := true; pending; {
+				select {
+				case id := <-s.pool.Dirty():
+					dirty[id] = true
+				default:
+					pending = false
+				}
+			}
+
+			if s.Config.RevalidateDirtyContainers {
+				s.revalidate(dirty)
+				if len(dirty) == 0 {
+					continue
+				}
+			}
+
+			if err := s.markAndRecreate(dirty); err != nil {
+				s.logger().Error("unable to recreate dirty containers", "deployment", s.Config.Deployment, "error", err)
+			}
+		}
+	}
+}
+
+func (s *ReqController) markAndRecreate(dirty map[string]bool) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	for _, c := range s.pool.Members() {
+		if dirty[c.Id] && !c.Dirty {
+			c.Dirty = true
+			s.notify(webhook.ContainerDirty, c)
+		}
+	}
+	s.pauseIfTooDirty()
+
+	return s.recreateDirtyContainers()
+}
+
+// ForceRecreateContainer replaces the container right away instead of waiting for the dirty
+// container cleanup, skipping revalidation. Only this container is replaced, and the
+// replacement is started if the container was running or the controller is static.
+func (s *ReqController) ForceRecreateContainer(id string) error {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+
+	for i, c := range s.pool.Members() {
+		if c.Id != id {
+			continue
+		}
+
+		if !c.Dirty {
+			c.Dirty = true
+			s.notify(webhook.ContainerDirty, c)
+		}
+		start := c.Started || s.Config.startsImmediately()
+
+		replacement, err := s.recreateContainer(i, c)
+		if err != nil {
+			return s.containerError(c.Id, err, "Unable to recreate container %s", c.Name)
+		}
+		if start {
+			if err := s.startContainer(replacement, nil); err != nil {
+				return s.containerError(replacement.Id, err, "Unable to start replacement of container %s", c.Name)
+			}
+		}
+		s.resumeIfRecovered()
+
+		return nil
+	}
+
+	return errors.New(fmt.Sprintf("Container %s not found in deployment %s", docker.ShortID(id), s.Config.Deployment))
+}
+
+// recreateContainer replaces the container at index i of the pool with a new one, which is
+// left stopped.
+func (s *ReqController) recreateContainer(i int, c *Container) (*Container, error) {
+	// The oom event may have been missed, e.g. while reconnecting to the daemon.
+	if atomic.LoadInt64(&c.OOMKillCount) == 0 {
+		if count, err := s.DockerCli.ContainerOOMCount(context.Background(), c.Id); err == nil && count > 0 {
+			s.recordOOMKill(c)
+		}
+	}
+
+	if s.Config.CrashDumpPath != "" && s.Config.CrashDumpDir != "" {
+		if err := s.FetchCrashDump(c.Id, s.Config.CrashDumpDir); err != nil {
+			s.logger().Warn("unable to fetch crash dump", "deployment", s.Config.Deployment, "name", c.Name, "error", err)
+		}
+	}
+
+	if err := s.removeContainer(c); err != nil {
+		return nil, err
+	}
+
+	replacement, err := s.newContainer(i)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pool.Replace(i, replacement)
+	s.syncContainers()
+	s.notify(webhook.ContainerRecreated, replacement)
+
+	return replacement, nil
+}
+
+// recreateDirtyContainers replaces dirty containers with new ones. Replacements are started
+// right away in static mode, and in dynamic mode if the rest of the pool is currently running.
+func (s *ReqController) recreateDirtyContainers() error {
+	startReplacements := s.Config.startsImmediately()
+	recreated := false
+
+	for i, c := range s.pool.Members() {
+		if !c.Dirty {
+			if c.Started {
+				startReplacements = true
+			}
+			continue
+		}
+
+		if _, err := s.recreateContainer(i, c); err != nil {
+			return err
+		}
+		recreated = true
+	}
+
+	if recreated && startReplacements {
+		if err := s.startContainers(); err != nil {
+			return err
+		}
+	}
+
+	if recreated {
+		s.resumeIfRecovered()
+	}
+
+	return nil
+}
+
+func (s *ReqController) removeContainer(c *Container) error {
+	if c.Started {
+		if err := s.DockerCli.KillContainer(c.Id); err != nil && !docker.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if err := s.DockerCli.RemoveContainer(c.Id); err != nil && !docker.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// age returns how long the container has been running, counting from its creation if the
+// start time isn't known.
+func (c Container) age() time.Duration {
+	if c.StartedAt.IsZero() {
+		return time.Since(c.CreatedAt)
+	}
+
+	return time.Since(c.StartedAt)
+}
@@ -0,0 +1,44 @@
+package fpm
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditFilesystemsReportsNewChanges(t *testing.T) {
+	daemon := newFakeDocker(t)
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+
+	var logs bytes.Buffer
+	s := newTestController(t, backend, func(conf *ControllerConfig) {
+		conf.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	})
+	container := &fakeContainer{name: "test", running: true, changes: []map[string]interface{}{
+		{"Path": "/tmp/sess_a", "Kind": 1},
+	}}
+	daemon.containers["test"] = container
+
+	s.auditFilesystems()
+	s.auditFilesystems()
+	if n := strings.Count(logs.String(), "/tmp/sess_a"); n != 1 {
+		t.Fatalf("expected an unchanged path to be reported once, got %d times:\n%s", n, logs.String())
+	}
+
+	daemon.lock.Lock()
+	container.changes = append(container.changes, map[string]interface{}{"Path": "/var/www/index.php", "Kind": 0})
+	daemon.lock.Unlock()
+	logs.Reset()
+
+	s.auditFilesystems()
+	if !strings.Contains(logs.String(), "/var/www/index.php") || strings.Contains(logs.String(), "/tmp/sess_a") {
+		t.Fatalf("expected only the new change to be reported, got:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "level=DEBUG") {
+		t.Errorf("expected changes to be logged at debug level, got:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,40 @@
+package fpm
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation.
+const listenFdsStart = 3
+
+// SystemdListener returns the socket passed by systemd socket activation, detected from the
+// LISTEN_PID and LISTEN_FDS environment variables. Nil is returned when the process wasn't
+// socket activated. Only the first passed socket is used.
+func SystemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	// The variables are meant for this process only, not for the ones it starts.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFdsStart), fmt.Sprintf("LISTEN_FD_%d", listenFdsStart))
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, serverError(err, "Unable to use the socket passed by systemd")
+	}
+
+	return l, nil
+}
@@ -0,0 +1,35 @@
+package fpm
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// tmpfsFlag matches options without a value, like noexec or ro.
+var tmpfsFlag = regexp.MustCompile(`^[a-z]+$`)
+
+// validateTmpfs checks that tmpfs mount paths are absolute and their options are key=value
+// pairs or plain flags.
+func validateTmpfs(conf ControllerConfig) error {
+	for p, options := range conf.TmpfsMounts {
+		if !path.IsAbs(p) {
+			return configError(conf, "tmpfs mount path %s is not absolute", p)
+		}
+		if options == "" {
+			continue
+		}
+
+		for _, opt := range strings.Split(options, ",") {
+			if tmpfsFlag.MatchString(opt) {
+				continue
+			}
+			k, v, found := strings.Cut(opt, "=")
+			if !found || k == "" || v == "" {
+				return configError(conf, "Invalid tmpfs mount option %q for %s", opt, p)
+			}
+		}
+	}
+
+	return nil
+}
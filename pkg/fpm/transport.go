@@ -0,0 +1,47 @@
+package fpm
+
+import (
+	"crypto/tls"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+)
+
+func newBackendTransport(conf ControllerConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.BackendTLSConfig != nil {
+		transport.TLSClientConfig = conf.BackendTLSConfig.Clone()
+	}
+
+	if conf.BackendH2C {
+		// ConfigureTransports negotiates HTTP/2 over TLS through TLSNextProto. Plain http://
+		// URLs are routed to an HTTP/2 transport dialing plain TCP instead of TLS, which gives
+		// us prior knowledge HTTP/2 over cleartext.
+		if _, err := http2.ConfigureTransports(transport); err != nil {
+			return nil, deploymentError(conf.Deployment, "", err, "Unable to configure HTTP/2 for backend transport")
+		}
+		transport.RegisterProtocol("http", &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		})
+	}
+
+	return transport, nil
+}
+
+// setConnectionPoolSize sets how many idle connections are kept open to each container. With
+// BackendH2C, requests are multiplexed over a single connection and the limit only applies
+// to backends falling back to HTTP/1.1.
+func (s *ReqController) setConnectionPoolSize(size int) {
+	transport, ok := s.HttpCli.Transport.(*http.Transport)
+	if !ok || size <= 0 {
+		return
+	}
+
+	transport.MaxIdleConnsPerHost = size
+	if transport.MaxIdleConns != 0 && transport.MaxIdleConns < size*s.Config.ContainerAmount {
+		transport.MaxIdleConns = size * s.Config.ContainerAmount
+	}
+}
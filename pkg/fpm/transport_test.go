@@ -0,0 +1,52 @@
+package fpm
+
+import (
+	"crypto/tls"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBackendTransportH2C(t *testing.T) {
+	conf := DefaultConfig("test", "php", "fpm", 9000)
+	conf.BackendH2C = true
+	conf.BackendTLSConfig = &tls.Config{ServerName: "backend"}
+
+	transport, err := newBackendTransport(conf)
+	if err != nil {
+		t.Fatalf("unable to create transport: %s", err)
+	}
+	if _, ok := transport.TLSNextProto[http2.NextProtoTLS]; !ok {
+		t.Errorf("expected TLSNextProto to be configured for %s", http2.NextProtoTLS)
+	}
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.ServerName != "backend" {
+		t.Error("expected BackendTLSConfig to be kept with BackendH2C")
+	}
+}
+
+func TestBackendH2CRoundTrip(t *testing.T) {
+	var proto string
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Proto
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	s := newTestController(t, backend, func(conf *ControllerConfig) {
+		conf.BackendH2C = true
+	})
+	s.setConnectionPoolSize(4)
+	if s.HttpCli.Transport.(*http.Transport).MaxIdleConnsPerHost != 4 {
+		t.Error("expected the connection pool size to apply with BackendH2C")
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if proto != "HTTP/2.0" {
+		t.Errorf("backend received %s, expected HTTP/2.0", proto)
+	}
+}
@@ -0,0 +1,33 @@
+package grpc
+
+import (
+	"encoding/json"
+	"google.golang.org/grpc"
+)
+
+// jsonCodec marshals the plain Go messages of this package, which don't implement proto.Message.
+// It isn't registered globally, so the codecs of other gRPC services in the process stay intact.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// ServerCodec returns the option for the gRPC server the service is registered to. The codec
+// applies to every service of that server, so it's best served on a server of its own.
+func ServerCodec() grpc.ServerOption {
+	return grpc.ForceServerCodec(jsonCodec{})
+}
+
+// CallCodec returns the option clients have to use when calling the service.
+func CallCodec() grpc.CallOption {
+	return grpc.ForceCodec(jsonCodec{})
+}
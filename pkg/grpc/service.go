@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"context"
+	"github.com/ajmyyra/docker-fpm/pkg/fpm"
+	"github.com/ajmyyra/docker-fpm/pkg/webhook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+)
+
+type Empty struct{}
+
+type DeploymentRequest struct {
+	Name string `json:"name"`
+}
+
+// DeploymentResponse mirrors fpm.Stats, including the health of every container.
+type DeploymentResponse struct {
+	fpm.Stats
+}
+
+type DeploymentList struct {
+	Deployments []DeploymentResponse `json:"deployments"`
+}
+
+type Event = webhook.Event
+
+// FPMServiceServer is the status service. Its messages are the plain Go types of this
+// package encoded as JSON, see ServerCodec and CallCodec.
+type FPMServiceServer interface {
+	GetDeployment(context.Context, *DeploymentRequest) (*DeploymentResponse, error)
+	ListDeployments(context.Context, *Empty) (*DeploymentList, error)
+	StreamEvents(*DeploymentRequest, grpc.ServerStream) error
+}
+
+// Server implements FPMService for a set of deployments, keyed by deployment name.
+type Server struct {
+	controllers map[string]*fpm.ReqController
+}
+
+func NewServer(controllers map[string]*fpm.ReqController) *Server {
+	return &Server{controllers: controllers}
+}
+
+// Register adds the service to a gRPC server created with the ServerCodec option.
+func (s *Server) Register(gs *grpc.Server) {
+	gs.RegisterService(&serviceDesc, s)
+}
+
+func (s *Server) controller(name string) (*fpm.ReqController, error) {
+	c, ok := s.controllers[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Deployment %s not found", name)
+	}
+
+	return c, nil
+}
+
+func (s *Server) GetDeployment(ctx context.Context, req *DeploymentRequest) (*DeploymentResponse, error) {
+	c, err := s.controller(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeploymentResponse{Stats: c.Stats()}, nil
+}
+
+func (s *Server) ListDeployments(ctx context.Context, req *Empty) (*DeploymentList, error) {
+	names := []string{}
+	for name := range s.controllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := &DeploymentList{Deployments: []DeploymentResponse{}}
+	for _, name := range names {
+		list.Deployments = append(list.Deployments, DeploymentResponse{Stats: s.controllers[name].Stats()})
+	}
+
+	return list, nil
+}
+
+// StreamEvents sends the deployment's lifecycle events until the client goes away.
+func (s *Server) StreamEvents(req *DeploymentRequest, stream grpc.ServerStream) error {
+	c, err := s.controller(req.Name)
+	if err != nil {
+		return err
+	}
+
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-events:
+			if err := stream.SendMsg(&event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "fpm.FPMService",
+	HandlerType: (*FPMServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetDeployment", Handler: getDeploymentHandler},
+		{MethodName: "ListDeployments", Handler: listDeploymentsHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "StreamEvents", Handler: streamEventsHandler, ServerStreams: true},
+	},
+}
+
+func getDeploymentHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &DeploymentRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FPMServiceServer).GetDeployment(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/fpm.FPMService/GetDeployment"}
+	return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FPMServiceServer).GetDeployment(ctx, req.(*DeploymentRequest))
+	})
+}
+
+func listDeploymentsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &Empty{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FPMServiceServer).ListDeployments(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/fpm.FPMService/ListDeployments"}
+	return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FPMServiceServer).ListDeployments(ctx, req.(*Empty))
+	})
+}
+
+func streamEventsHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &DeploymentRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+
+	return srv.(FPMServiceServer).StreamEvents(req, stream)
+}
@@ -0,0 +1,47 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+)
+
+// Environment variables holding PEM-encoded certificates, e.g. from Kubernetes secrets.
+const (
+	CertEnv = "TLS_CERT_PEM"
+	KeyEnv  = "TLS_KEY_PEM"
+	CAEnv   = "TLS_CA_PEM"
+)
+
+// NewBackendTLSConfigFromEnv builds a TLS config for connecting to containers from the
+// environment. TLS_CA_PEM is used to verify the containers and TLS_CERT_PEM with TLS_KEY_PEM
+// as the client certificate for mTLS. Nil is returned when none of them is set.
+func NewBackendTLSConfigFromEnv() (*tls.Config, error) {
+	certPEM, keyPEM, caPEM := os.Getenv(CertEnv), os.Getenv(KeyEnv), os.Getenv(CAEnv)
+	if certPEM == "" && keyPEM == "" && caPEM == "" {
+		return nil, nil
+	}
+
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if certPEM != "" || keyPEM != "" {
+		if certPEM == "" || keyPEM == "" {
+			return nil, configError(nil, "Both %s and %s are required for a client certificate", CertEnv, KeyEnv)
+		}
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			return nil, configError(err, "Unable to load client certificate from %s and %s", CertEnv, KeyEnv)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if caPEM != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+			return nil, configError(nil, "No valid certificates in %s", CAEnv)
+		}
+		conf.RootCAs = pool
+	}
+
+	return conf, nil
+}
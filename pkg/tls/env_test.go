@@ -0,0 +1,37 @@
+package tls
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewBackendTLSConfigFromEnv(t *testing.T) {
+	certPEM, keyPEM := selfSigned(t)
+
+	for name, env := range map[string][3]string{
+		"key without certificate": {"", string(keyPEM), ""},
+		"invalid key pair":        {string(certPEM), "not a key", ""},
+		"invalid CA":              {"", "", "not a certificate"},
+	} {
+		t.Setenv(CertEnv, env[0])
+		t.Setenv(KeyEnv, env[1])
+		t.Setenv(CAEnv, env[2])
+
+		_, err := NewBackendTLSConfigFromEnv()
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("%s: expected a ConfigError, got %v", name, err)
+		}
+	}
+
+	t.Setenv(CertEnv, string(certPEM))
+	t.Setenv(KeyEnv, string(keyPEM))
+	t.Setenv(CAEnv, string(certPEM))
+	conf, err := NewBackendTLSConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unable to build TLS config: %s", err)
+	}
+	if len(conf.Certificates) != 1 || conf.RootCAs == nil {
+		t.Error("expected the client certificate and the CA to be set")
+	}
+}
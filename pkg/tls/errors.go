@@ -0,0 +1,33 @@
+package tls
+
+import "fmt"
+
+// ConfigError is returned when a TLS config can't be built from the given certificates.
+// OriginalError is nil when the certificates were read but aren't usable.
+type ConfigError struct {
+	Message       string
+	OriginalError error
+}
+
+func (e *ConfigError) Error() string {
+	if e.OriginalError == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.OriginalError)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.OriginalError
+}
+
+// Cause allows pkg/errors to see the underlying error.
+func (e *ConfigError) Cause() error {
+	return e.OriginalError
+}
+
+func configError(err error, format string, args ...interface{}) error {
+	return &ConfigError{
+		Message:       fmt.Sprintf(format, args...),
+		OriginalError: err,
+	}
+}
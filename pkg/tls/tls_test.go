@@ -0,0 +1,89 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSigned returns a PEM-encoded self-signed certificate and its key.
+func selfSigned(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "docker-fpm"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestNewBackendTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, keyPEM := selfSigned(t)
+	cert := writeFile(t, dir, "client.crt", certPEM)
+	key := writeFile(t, dir, "client.key", keyPEM)
+	garbage := writeFile(t, dir, "garbage.pem", []byte("not a certificate"))
+	missing := filepath.Join(dir, "missing.pem")
+
+	conf, err := NewBackendTLSConfig(cert, key, cert)
+	if err != nil {
+		t.Fatalf("unable to build TLS config: %s", err)
+	}
+	if len(conf.Certificates) != 1 || conf.RootCAs == nil {
+		t.Error("expected the client certificate and the CA to be set")
+	}
+
+	for name, files := range map[string][3]string{
+		"missing certificate": {missing, key, cert},
+		"missing CA":          {cert, key, missing},
+		"invalid CA":          {cert, key, garbage},
+	} {
+		_, err := NewBackendTLSConfig(files[0], files[1], files[2])
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("%s: expected a ConfigError, got %v", name, err)
+		}
+	}
+
+	_, err = NewBackendTLSConfig(cert, key, missing)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the error to wrap the missing file, got %v", err)
+	}
+}
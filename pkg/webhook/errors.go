@@ -0,0 +1,37 @@
+package webhook
+
+import "fmt"
+
+// DeliveryError is returned when an event can't be delivered to the webhook URL. StatusCode
+// is set when the webhook responded with an error status.
+type DeliveryError struct {
+	Message       string
+	URL           string
+	StatusCode    int
+	OriginalError error
+}
+
+func (e *DeliveryError) Error() string {
+	if e.OriginalError == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.OriginalError)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.OriginalError
+}
+
+// Cause allows pkg/errors to see the underlying error.
+func (e *DeliveryError) Cause() error {
+	return e.OriginalError
+}
+
+func (c Client) deliveryError(status int, err error, format string, args ...interface{}) error {
+	return &DeliveryError{
+		Message:       fmt.Sprintf(format, args...),
+		URL:           c.config.URL,
+		StatusCode:    status,
+		OriginalError: err,
+	}
+}
@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	ContainerStarted   = "container_started"
+	ContainerDirty     = "container_dirty"
+	ContainerRecreated = "container_recreated"
+	PoolExhausted      = "pool_exhausted"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of the payload, keyed with the secret.
+const SignatureHeader = "X-FPM-Signature"
+
+const retryBaseDelay = 500 * time.Millisecond
+
+type Event struct {
+	Type          string    `json:"type"`
+	Deployment    string    `json:"deployment"`
+	ContainerID   string    `json:"containerId,omitempty"`
+	ContainerName string    `json:"containerName,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+type Config struct {
+	URL    string
+	Secret string
+	// Amount of attempts for delivering an event. Values below 2 disable retrying.
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+type Client struct {
+	cli    *http.Client
+	config Config
+}
+
+func NewClient(config Config) Client {
+	return Client{
+		cli:    &http.Client{Timeout: config.Timeout},
+		config: config,
+	}
+}
+
+// SendWebhook posts the event as JSON to the configured URL, retrying with exponential backoff
+// on connection errors and 5xx responses.
+func (c Client) SendWebhook(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return c.deliveryError(0, err, "Unable to encode webhook event")
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.config.Secret))
+	mac.Write(payload)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	for attempt := 1; ; attempt++ {
+		retryable, err := c.post(payload, signature)
+		if err == nil || !retryable || attempt >= c.config.MaxAttempts {
+			return err
+		}
+		time.Sleep(retryBaseDelay << (attempt - 1))
+	}
+}
+
+// post sends the payload once, telling whether a failure is worth retrying.
+func (c Client) post(payload []byte, signature string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, c.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, c.deliveryError(0, err, "Unable to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+
+	res, err := c.cli.Do(req)
+	if err != nil {
+		return true, c.deliveryError(0, err, "Unable to send webhook to %s", c.config.URL)
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return res.StatusCode >= 500, c.deliveryError(res.StatusCode, nil, "Webhook %s responded with %d", c.config.URL, res.StatusCode)
+	}
+
+	return false, nil
+}
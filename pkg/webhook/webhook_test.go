@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendWebhookErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewClient(Config{URL: server.URL, MaxAttempts: 3}).SendWebhook(Event{Type: ContainerStarted})
+	var deliveryErr *DeliveryError
+	if !errors.As(err, &deliveryErr) {
+		t.Fatalf("expected a DeliveryError, got %v", err)
+	}
+	if deliveryErr.StatusCode != http.StatusBadRequest || deliveryErr.URL != server.URL {
+		t.Errorf("expected status 400 from %s, got %d from %s", server.URL, deliveryErr.StatusCode, deliveryErr.URL)
+	}
+	if attempts != 1 {
+		t.Errorf("expected a 4xx response not to be retried, got %d attempts", attempts)
+	}
+
+	server.Close()
+	err = NewClient(Config{URL: server.URL}).SendWebhook(Event{Type: ContainerStarted})
+	if !errors.As(err, &deliveryErr) || deliveryErr.OriginalError == nil {
+		t.Fatalf("expected a DeliveryError wrapping the connection error, got %v", err)
+	}
+}